@@ -0,0 +1,167 @@
+package ytttransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	//AuditOverride ERC20 address overridden by operator
+	AuditOverride = "override"
+	//AuditRefetch key and balance of account re-fetched from chain
+	AuditRefetch = "refetch"
+)
+
+const (
+	//StatusAll all accounts
+	StatusAll = ""
+	//StatusRegistered accounts which have registered an ERC20 address
+	StatusRegistered = "registered"
+	//StatusUnregistered accounts which are not excluded and have not registered an ERC20 address
+	StatusUnregistered = "unregistered"
+	//StatusExcluded accounts excluded from distribution
+	StatusExcluded = "excluded"
+	//StatusLate accounts added after snapshot
+	StatusLate = "late"
+	//StatusChanged accounts which have changed their ERC20 address
+	StatusChanged = "changed"
+	//StatusQueued accounts queued for payout
+	StatusQueued = PayoutQueued
+	//StatusPaid accounts which have been paid
+	StatusPaid = PayoutPaid
+)
+
+//ErrUnknownStatus account status to list is unknown
+var ErrUnknownStatus = errors.New("unknown account status")
+
+//statusFilter query of registry entries in status
+func statusFilter(status string) (bson.M, error) {
+	switch status {
+	case StatusAll:
+		return bson.M{}, nil
+	case StatusRegistered:
+		return bson.M{"ethaddr": bson.M{"$ne": ""}}, nil
+	case StatusUnregistered:
+		return bson.M{"ethaddr": "", "exclude": false}, nil
+	case StatusExcluded:
+		return bson.M{"exclude": true}, nil
+	case StatusLate:
+		return bson.M{"late": true}, nil
+	case StatusChanged:
+		return bson.M{"changes": bson.M{"$gt": 0}}, nil
+	case StatusQueued, StatusPaid:
+		return bson.M{"payoutstatus": status}, nil
+	default:
+		return nil, ErrUnknownStatus
+	}
+}
+
+//SetExclude exclude account from or include it in distribution with reason
+func (client *Mongoc) SetExclude(account string, exclude bool, reason string, origin *Origin) error {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	return client.Audit(AuditExclude, account, bson.M{"exclude": exclude, "reason": reason}, origin, func() error {
+		ret, err := collection.UpdateOne(context.Background(), bson.M{"_id": account}, bson.M{"$set": bson.M{"exclude": exclude, "excludereason": reason}})
+		if err != nil {
+			log.Printf("!!! error when set exclude: %s -> %s\n", account, err.Error())
+			return err
+		}
+		if ret.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return nil
+	})
+}
+
+//OverrideEthAddr replace ERC20 address of account bypassing registration policy, the previous address is pushed to history,
+//returns ErrPayoutFrozen if account is queued for payout or has been paid
+func (client *Mongoc) OverrideEthAddr(account, ethaddr, justification string, origin *Origin) error {
+	reg, err := client.GetAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	if reg.PayoutStatus != "" {
+		return ErrPayoutFrozen
+	}
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	now := time.Now().Unix()
+	update := bson.M{"$set": bson.M{"ethaddr": ethaddr, "ethverified": false, "ethcontract": false, "registeredat": now}}
+	if reg.EthAddr != "" && reg.EthAddr != ethaddr {
+		update["$push"] = bson.M{"history": &EthAddrChange{EthAddr: reg.EthAddr, RegisteredAt: reg.RegisteredAt, ReplacedAt: now}}
+	}
+	return client.Audit(AuditOverride, account, bson.M{"ethaddr": ethaddr, "prev": reg.EthAddr, "justification": justification}, origin, func() error {
+		ret, err := collection.UpdateOne(context.Background(), bson.M{"_id": account, "ethaddr": reg.EthAddr, "payoutstatus": bson.M{"$in": bson.A{nil, ""}}}, update)
+		if err != nil {
+			log.Printf("!!! error when override ethaddress: %s -> %s : %s\n", account, ethaddr, err.Error())
+			return err
+		}
+		if ret.MatchedCount == 0 {
+			return ErrRegistryChanged
+		}
+		return nil
+	})
+}
+
+//UpdateKeyBalance update public key and balance of account re-fetched from chain,
+//returns ErrPayoutFrozen if account is queued for payout or has been paid since its payout amount is fixed
+func (client *Mongoc) UpdateKeyBalance(account, pubkey string, balance int64, origin *Origin) error {
+	reg, err := client.GetAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	if reg.PayoutStatus != "" {
+		return ErrPayoutFrozen
+	}
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	return client.Audit(AuditRefetch, account, bson.M{"pubkey": pubkey, "balance": balance}, origin, func() error {
+		ret, err := collection.UpdateOne(context.Background(), bson.M{"_id": account, "payoutstatus": bson.M{"$in": bson.A{nil, ""}}}, bson.M{"$set": bson.M{"pubkey": pubkey, "balance": balance}})
+		if err != nil {
+			log.Printf("!!! error when update key and balance: %s -> %s\n", account, err.Error())
+			return err
+		}
+		if ret.MatchedCount == 0 {
+			return ErrRegistryChanged
+		}
+		return nil
+	})
+}
+
+//ListAccounts list registry entries in status ordered by account, skip and limit page through the result
+func (client *Mongoc) ListAccounts(status string, skip, limit int64) ([]*Registry, error) {
+	filter, err := statusFilter(status)
+	if err != nil {
+		return nil, err
+	}
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	cur, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"_id": 1}).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		log.Printf("!!! error when list accounts: %s\n", err.Error())
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	regs := make([]*Registry, 0)
+	for cur.Next(context.Background()) {
+		reg := new(Registry)
+		err := cur.Decode(reg)
+		if err != nil {
+			log.Printf("!!! error when decode registry: %s\n", err.Error())
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, cur.Err()
+}
+
+//AdminMessage text signed by operator key in a signed admin request: method, request URI, unix timestamp and hex encoded sha256 of body on separate lines
+func AdminMessage(method, requestURI, timestamp string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n%s", method, requestURI, timestamp, hex.EncodeToString(digest[:])))
+}
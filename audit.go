@@ -0,0 +1,182 @@
+package ytttransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	//AuditSnapshot snapshot entry inserted
+	AuditSnapshot = "snapshot"
+	//AuditRegistry account added to registry
+	AuditRegistry = "registry"
+	//AuditLate account missing from snapshot added to registry
+	AuditLate = "late"
+	//AuditRegister ERC20 address registered for the first time
+	AuditRegister = "register"
+	//AuditChange registered ERC20 address changed
+	AuditChange = "change"
+	//AuditExclude account excluded from or included in distribution
+	AuditExclude = "exclude"
+	//AuditPayout payout state of account changed
+	AuditPayout = "payout"
+)
+
+const (
+	//AuditPending entry is appended and its mutation is not finished, a pending entry left behind must be checked against registry
+	AuditPending = "pending"
+	//AuditDone mutation of entry is applied
+	AuditDone = "done"
+	//AuditAborted mutation of entry is not applied
+	AuditAborted = "aborted"
+)
+
+//auditRetries how many times appending is retried when another entry is appended concurrently
+const auditRetries = 10
+
+//ErrAuditBroken audit log chain is not intact
+var ErrAuditBroken = errors.New("audit log is broken")
+
+//Origin who requested a registry mutation, nil origin means the operator running a local command
+type Origin struct {
+	Signature string
+	ClientIP  string
+}
+
+//AuditEntry entry of append-only audit log, each entry is linked to previous one by its hash
+type AuditEntry struct {
+	Seq       int64  `json:"seq" bson:"_id"`
+	Action    string `json:"action"`
+	Account   string `json:"account"`
+	Data      string `json:"data"` // JSON encoded details of the mutation
+	Signature string `json:"signature"`
+	ClientIP  string `json:"clientip"`
+	Timestamp int64  `json:"timestamp"`
+	PrevHash  string `json:"prevhash"`
+	Hash      string `json:"hash"`
+	State     string `json:"state"` // outcome of the mutation, not covered by hash since it is set after appending
+}
+
+//ComputeHash hex encoded sha256 of JSON array of all other fields of entry except state,
+//JSON quoting keeps contents of one field from being shifted into another
+func (e *AuditEntry) ComputeHash() string {
+	b, _ := json.Marshal([]interface{}{e.Seq, e.Action, e.Account, e.Data, e.Signature, e.ClientIP, e.Timestamp, e.PrevHash})
+	digest := sha256.Sum256(b)
+	return hex.EncodeToString(digest[:])
+}
+
+//Audit append a pending entry of mutation to audit log, then apply the mutation and record its outcome,
+//the mutation is not applied if the entry cannot be appended, error of mutation is returned
+func (client *Mongoc) Audit(action, account string, data interface{}, origin *Origin, mutate func() error) error {
+	seq, err := client.appendAudit(action, account, data, origin)
+	if err != nil {
+		return err
+	}
+	state := AuditDone
+	mutErr := mutate()
+	if mutErr != nil {
+		state = AuditAborted
+	}
+	collection := client.Client.Database("ytttransfer").Collection("audit")
+	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": seq}, bson.M{"$set": bson.M{"state": state}})
+	if err != nil {
+		// the entry stays pending and is reported by VerifyAudit
+		log.Printf("!!! error when set state of audit entry %d: %s -> %s\n", seq, state, err.Error())
+	}
+	return mutErr
+}
+
+//appendAudit append a pending entry to audit log, returns its sequence number
+func (client *Mongoc) appendAudit(action, account string, data interface{}, origin *Origin) (int64, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	if origin == nil {
+		origin = &Origin{ClientIP: "local"}
+	}
+	collection := client.Client.Database("ytttransfer").Collection("audit")
+	for i := 0; i < auditRetries; i++ {
+		last := new(AuditEntry)
+		err = collection.FindOne(context.Background(), bson.M{}, options.FindOne().SetSort(bson.M{"_id": -1})).Decode(last)
+		if err != nil && !strings.Contains(err.Error(), "no documents in result") {
+			log.Printf("!!! error when find last audit entry: %s\n", err.Error())
+			return 0, err
+		}
+		entry := &AuditEntry{Seq: last.Seq + 1, Action: action, Account: account, Data: string(b), Signature: origin.Signature, ClientIP: origin.ClientIP, Timestamp: time.Now().Unix(), PrevHash: last.Hash, State: AuditPending}
+		entry.Hash = entry.ComputeHash()
+		_, err = collection.InsertOne(context.Background(), entry)
+		if err == nil {
+			return entry.Seq, nil
+		}
+		if !strings.Contains(err.Error(), "duplicate key") {
+			log.Printf("!!! error when append audit entry: %s %s -> %s\n", action, account, err.Error())
+			return 0, err
+		}
+	}
+	log.Printf("!!! error when append audit entry: %s %s -> %s\n", action, account, err.Error())
+	return 0, err
+}
+
+//VerifyAudit check sequence numbers, hashes and links of all entries in audit log,
+//returns number of entries checked and sequence numbers of entries still pending
+func (client *Mongoc) VerifyAudit() (int64, []int64, error) {
+	collection := client.Client.Database("ytttransfer").Collection("audit")
+	cur, err := collection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer cur.Close(context.Background())
+	chain := newAuditChain()
+	for cur.Next(context.Background()) {
+		entry := new(AuditEntry)
+		err := cur.Decode(entry)
+		if err != nil {
+			return chain.count, chain.pending, err
+		}
+		if err := chain.next(entry); err != nil {
+			return chain.count, chain.pending, err
+		}
+	}
+	return chain.count, chain.pending, cur.Err()
+}
+
+//auditChain entries of audit log checked so far
+type auditChain struct {
+	count    int64
+	prevHash string
+	pending  []int64
+}
+
+func newAuditChain() *auditChain {
+	return &auditChain{pending: make([]int64, 0)}
+}
+
+//next check sequence number, link and hash of entry following those checked so far
+func (chain *auditChain) next(entry *AuditEntry) error {
+	if entry.Seq != chain.count+1 {
+		return fmt.Errorf("%w: entry %d is missing", ErrAuditBroken, chain.count+1)
+	}
+	if entry.PrevHash != chain.prevHash {
+		return fmt.Errorf("%w: entry %d does not link to previous entry", ErrAuditBroken, entry.Seq)
+	}
+	if entry.Hash != entry.ComputeHash() {
+		return fmt.Errorf("%w: hash mismatch of entry %d", ErrAuditBroken, entry.Seq)
+	}
+	if entry.State == AuditPending {
+		chain.pending = append(chain.pending, entry.Seq)
+	}
+	chain.prevHash = entry.Hash
+	chain.count++
+	return nil
+}
@@ -0,0 +1,84 @@
+package ytttransfer
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+//testAuditLog chain of n entries linked by their hashes, entry 2 is pending
+func testAuditLog(n int) []*AuditEntry {
+	entries := make([]*AuditEntry, 0, n)
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		e := &AuditEntry{Seq: int64(i), Action: AuditRegister, Account: "alice", Data: `{"ethaddr":"0x` + strconv.Itoa(i) + `"}`, ClientIP: "local", Timestamp: int64(i), PrevHash: prevHash, State: AuditDone}
+		if i == 2 {
+			e.State = AuditPending
+		}
+		e.Hash = e.ComputeHash()
+		prevHash = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+//checkAuditLog check entries in order, returns the chain checked so far and the first error
+func checkAuditLog(entries []*AuditEntry) (*auditChain, error) {
+	chain := newAuditChain()
+	for _, e := range entries {
+		if err := chain.next(e); err != nil {
+			return chain, err
+		}
+	}
+	return chain, nil
+}
+
+func TestAuditComputeHash(t *testing.T) {
+	e := &AuditEntry{Seq: 1, Action: AuditRegister, Account: "alice", Data: `{"ethaddr":"0x1"}`, ClientIP: "local", Timestamp: 1}
+	if h := e.ComputeHash(); h != "63c04024ef2ef639d8b013d21233bf77bf7bb3a6dbd91c87dabb8c18ea882ec6" {
+		t.Fatalf("hash is %s", h)
+	}
+	e.State = AuditAborted
+	if h := e.ComputeHash(); h != "63c04024ef2ef639d8b013d21233bf77bf7bb3a6dbd91c87dabb8c18ea882ec6" {
+		t.Fatal("hash covers state")
+	}
+	shifted := &AuditEntry{Seq: 1, Action: AuditRegister, Account: "alice" + `{"ethaddr":"0x1"}`, ClientIP: "local", Timestamp: 1}
+	if shifted.ComputeHash() == e.ComputeHash() {
+		t.Fatal("contents shifted between fields have the same hash")
+	}
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	chain, err := checkAuditLog(testAuditLog(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.count != 3 || len(chain.pending) != 1 || chain.pending[0] != 2 {
+		t.Fatalf("checked %d entries, pending %v", chain.count, chain.pending)
+	}
+
+	for _, c := range []struct {
+		name   string
+		tamper func([]*AuditEntry) []*AuditEntry
+		count  int64
+	}{
+		{"modified data", func(l []*AuditEntry) []*AuditEntry { l[1].Data = `{"ethaddr":"0x9"}`; return l }, 1},
+		{"modified timestamp", func(l []*AuditEntry) []*AuditEntry { l[2].Timestamp++; return l }, 2},
+		{"rehashed entry", func(l []*AuditEntry) []*AuditEntry { l[1].Account = "bob"; l[1].Hash = l[1].ComputeHash(); return l }, 2},
+		{"removed entry", func(l []*AuditEntry) []*AuditEntry { return append(l[:1], l[2:]...) }, 1},
+		{"removed first entry", func(l []*AuditEntry) []*AuditEntry { return l[1:] }, 0},
+		{"reordered entries", func(l []*AuditEntry) []*AuditEntry { l[1], l[2] = l[2], l[1]; return l }, 1},
+		{"renumbered entry", func(l []*AuditEntry) []*AuditEntry { l[2].Seq = 4; return l }, 2},
+	} {
+		chain, err := checkAuditLog(c.tamper(testAuditLog(3)))
+		if !errors.Is(err, ErrAuditBroken) || chain.count != c.count {
+			t.Fatalf("%s: checked %d entries: %v", c.name, chain.count, err)
+		}
+	}
+
+	entries := testAuditLog(3)
+	entries[1].State = AuditDone
+	if _, err := checkAuditLog(entries); err != nil {
+		t.Fatalf("state change breaks the chain: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//RegRequest body of POST /reg
+type RegRequest struct {
+	Account       string `json:"account"`
+	EthAddr       string `json:"ethaddr"`
+	Nonce         string `json:"nonce"`
+	IssuedAt      int64  `json:"issuedAt"`
+	Expiry        int64  `json:"expiry"`
+	Sig           string `json:"sig"`
+	SigType       string `json:"sigType"` // raw (default), scatter or esr
+	EthSig        string `json:"ethSig"`
+	EthSigType    string `json:"ethSigType"`    // personal (EIP-191, default) or eip712
+	AllowContract bool   `json:"allowContract"` // register ethaddr even if it is a contract
+}
+
+//LateRequest body of POST /late, signed by current active key of account
+type LateRequest struct {
+	Account  string `json:"account"`
+	IssuedAt int64  `json:"issuedAt"`
+	Expiry   int64  `json:"expiry"`
+	Sig      string `json:"sig"`
+}
+
+//RegistryClient client of registry server
+type RegistryClient struct {
+	URL    string
+	Client *http.Client
+}
+
+type registryResp struct {
+	Code  int             `json:"code"`
+	Error string          `json:"error"`
+	Data  json.RawMessage `json:"data"`
+	Msg   string          `json:"msg"`
+}
+
+//NewRegistryClient create a client of registry server listening at url
+func NewRegistryClient(url string) *RegistryClient {
+	return &RegistryClient{URL: strings.TrimRight(url, "/"), Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+//Nonce request a registration message with a fresh nonce for account and ethaddr
+func (c *RegistryClient) Nonce(account, ethaddr string) (*RegMessage, error) {
+	resp, err := c.Client.Get(fmt.Sprintf("%s/nonce?account=%s&ethaddr=%s", c.URL, url.QueryEscape(account), url.QueryEscape(ethaddr)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	msg := new(RegMessage)
+	err = decodeRegistryResp(resp, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+//Register post signed registration request
+func (c *RegistryClient) Register(req *RegRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Post(c.URL+"/reg", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeRegistryResp(resp, nil)
+}
+
+//LateRegister post signed late registration request, returns balance recorded in registry
+func (c *RegistryClient) LateRegister(req *LateRequest) (int64, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Client.Post(c.URL+"/late", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var balance int64
+	err = decodeRegistryResp(resp, &balance)
+	return balance, err
+}
+
+//SignAndRegister fetch a nonce, sign registration message by EOS private key and post it
+func (c *RegistryClient) SignAndRegister(privateKey, account, ethaddr string) (*RegRequest, error) {
+	msg, err := c.Nonce(account, ethaddr)
+	if err != nil {
+		return nil, err
+	}
+	msg.EthAddr = ethaddr
+	sig, err := SignRegistration(privateKey, msg)
+	if err != nil {
+		return nil, err
+	}
+	req := &RegRequest{Account: account, EthAddr: ethaddr, Nonce: msg.Nonce, IssuedAt: msg.IssuedAt, Expiry: msg.Expiry, Sig: sig}
+	return req, c.Register(req)
+}
+
+func decodeRegistryResp(resp *http.Response, data interface{}) error {
+	r := new(registryResp)
+	err := json.NewDecoder(resp.Body).Decode(r)
+	if err != nil {
+		return fmt.Errorf("invalid response of registry (HTTP %d): %s", resp.StatusCode, err.Error())
+	}
+	if r.Code != 0 {
+		return fmt.Errorf("registry error %d %s: %s", r.Code, r.Error, r.Msg)
+	}
+	if data != nil {
+		return json.Unmarshal(r.Data, data)
+	}
+	return nil
+}
+
+//SignAdminRequest sign admin request to registry server by operator private key, body of req is buffered
+func SignAdminRequest(req *http.Request, privateKey string, now time.Time) error {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		body = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	sig, err := Sign(privateKey, AdminMessage(req.Method, req.URL.RequestURI(), timestamp, body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Admin-Timestamp", timestamp)
+	req.Header.Set("X-Admin-Signature", sig)
+	return nil
+}
@@ -1,25 +1,31 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	yt "github.com/aurawing/ytttransfer"
 	"github.com/aurawing/ytttransfer/eostx"
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/aurawing/ytttransfer/server"
+	ecrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-type Req struct {
-	Account string `json:"account"`
-	EthAddr string `json:"ethaddr"`
-	Sig     string `json:"sig"`
-}
-
 func main1() {
 	tokenSess := yt.InitTranns("http://127.0.0.1:7545", "0xfA783e105BdB7Acab8Ee9c54f55152CAB7780c83")
 	err := tokenSess.Transaction("0x70Ff94919370145D854Ab3E61e13b59f74638e7e", "ddee5ca793baa4608f863fbb050cfc13a77d92f430f4aa493d00f16c6c123b78", 100)
@@ -34,10 +40,129 @@ func main() {
 	mongoURL := flag.String("mongo-url", "mongodb://127.0.0.1:27017", "MongoDB URL")
 	eosURL := flag.String("eos-url", "http://129.28.188.167:8888", "EOS URL")
 	snapshot := flag.Bool("snapshot", false, "Take a snapshot of EOS balance")
+	snapshotID := flag.String("snapshot-id", "", "ID of the snapshot to take, empty for the default snapshot which feeds registry, other IDs only take a comparison snapshot for -diff")
+	diff := flag.Bool("diff", false, "Compare two snapshots given by -from and -to")
+	diffFrom := flag.String("from", "", "ID of the older snapshot to compare")
+	diffTo := flag.String("to", "", "ID of the newer snapshot to compare")
+	out := flag.String("out", "", "Output file of CSV result, empty for stdout")
+	export := flag.Bool("export", false, "Export the final distribution with merkle root and signed manifest, registry is not modified")
+	exportDir := flag.String("export-dir", ".", "Output directory of exported distribution")
+	queuePayout := flag.Bool("queue-payout", false, "Queue accounts of distribution.json in -export-dir for payout which freezes their ERC20 addresses")
+	ethKeyFile := flag.String("eth-key-file", "", "File containing hex encoded Ethereum private key of operator")
+	proofFile := flag.String("proof-file", "", "Serve merkle proofs of the frozen distribution.json written by -export, disabled if empty")
+	domain := flag.String("domain", "ytttransfer", "Domain name of registration messages")
+	chainID := flag.String("chain-id", "", "Chain ID of registration messages, fetched from EOS node if empty")
+	nonceTTL := flag.Duration("nonce-ttl", 30*time.Minute, "Validity period of registration nonces")
+	nonceKeyFile := flag.String("nonce-key-file", "", "File containing HMAC key of registration nonces, a random key is used if empty and outstanding nonces are invalidated on restart")
+	requireEthSig := flag.Bool("require-eth-sig", false, "Require registration to be signed by the ERC20 address too")
+	eip712Version := flag.String("eip712-version", "1", "Version of EIP-712 domain, its name is the domain of registration messages")
+	ethChainID := flag.Int64("eth-chain-id", 1, "Ethereum chain ID of EIP-712 domain")
+	verifyAudit := flag.Bool("verify-audit", false, "Verify that the hash chain of audit log is intact")
+	inspect := flag.Bool("inspect", false, "Inspect a registration signature given by -account, -ethaddr, -nonce, -issued-at, -expiry and -sig")
+	sign := flag.Bool("sign", false, "Sign a registration given by -account and -ethaddr with -private-key-file, posted to -registry-url if set, otherwise -nonce, -issued-at and -expiry are signed offline")
+	inspAccount := flag.String("account", "", "EOS account of the registration to inspect or sign")
+	inspEthAddr := flag.String("ethaddr", "", "ERC20 address of the registration to inspect or sign")
+	inspNonce := flag.String("nonce", "", "Nonce of the registration to inspect or sign")
+	inspIssuedAt := flag.Int64("issued-at", 0, "Issued-at unix time of the registration to inspect or sign")
+	inspExpiry := flag.Int64("expiry", 0, "Expiry unix time of the registration to inspect or sign")
+	inspSig := flag.String("sig", "", "EOS signature of the registration to inspect")
+	inspSigType := flag.String("sig-type", yt.SigTypeRaw, "Signing convention of the registration to inspect: raw, scatter or esr")
+	privateKeyFile := flag.String("private-key-file", "", "File containing EOS private key in WIF or PVT_K1_ format used by -sign")
+	registryURL := flag.String("registry-url", "", "URL of registry server which signed registration is posted to")
+	keyPolicy := flag.String("key-policy", yt.KeyPolicySnapshot, "Which key must sign registrations: snapshot, chain or both")
+	regOpen := flag.String("reg-open", "", "Registration opens at this RFC 3339 time, no limit if empty")
+	regClose := flag.String("reg-close", "", "Registration closes at this RFC 3339 time, no limit if empty")
+	maxChanges := flag.Int("max-changes", -1, "How many times a registered ERC20 address can be changed, unlimited if negative")
+	changeDeadline := flag.String("change-deadline", "", "Registered ERC20 address cannot be changed after this RFC 3339 time, no limit if empty")
+	late := flag.Bool("late", false, "Accept late registrations of accounts missing from snapshot at POST /late, or sign a late registration of -account with -sign")
+	lateCutoff := flag.String("late-cutoff", "", "Accounts created after this RFC 3339 time cannot register late, no limit if empty")
+	lateExclude := flag.String("late-exclude", "eosio,eosio.*", "Comma separated accounts excluded from late registration, an entry ending with * is a prefix")
+	adminKeyFile := flag.String("admin-key-file", "", "File containing API key of operators for /admin, API key authentication is disabled if empty")
+	adminPubKeys := flag.String("admin-pubkeys", "", "Comma separated EOS public keys of operators which sign /admin requests")
+	rateIP := flag.Float64("rate-ip", 5, "Requests per second allowed per client IP, unlimited if 0")
+	burstIP := flag.Int("burst-ip", 20, "Burst of requests allowed per client IP")
+	rateAccount := flag.Float64("rate-account", 1, "Requests per second allowed per account on queries, and on /reg and /late once the signature is verified, unlimited if 0")
+	burstAccount := flag.Int("burst-account", 5, "Burst of requests allowed per account")
+	proxyHeader := flag.String("proxy-header", "", "Header carrying client IP set by trusted reverse proxy, e.g. X-Real-IP or X-Forwarded-For, empty to use remote address")
+	trustedProxies := flag.String("trusted-proxies", "127.0.0.1,::1", "Comma separated IPs or CIDRs of reverse proxies whose -proxy-header is trusted")
+	batchMax := flag.Int("batch-max", server.DefaultBatchLimit, "Max accounts of a POST /batch query")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "Max duration of reading a request including its body")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "Max duration from the end of reading request headers to the end of writing response")
+	idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "Max duration a keep-alive connection waits for the next request")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Max duration of draining in-flight requests on SIGTERM")
+	maxBody := flag.Int64("max-body", 1<<20, "Max size of request body in bytes")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file, serve HTTPS if set together with -tls-key, reloaded on SIGHUP")
+	tlsKey := flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	ethURL := flag.String("eth-url", "", "Ethereum RPC URL used to detect contract addresses on registration, disabled if empty")
 	port := flag.Int("port", 8080, "Listening port")
+	metricsAddr := flag.String("metrics-addr", "", "Private listen address of /metrics, e.g. 127.0.0.1:9100, disabled if empty")
+	metricsTokenFile := flag.String("metrics-token-file", "", "File containing bearer token of /metrics on the public port, not served there if empty")
+	probeInterval := flag.Duration("probe-interval", 5*time.Second, "Interval of checking MongoDB and EOS node for /readyz and counting registry for /metrics")
 	daemon := flag.Bool("d", false, "Run as registry server")
 	flag.Parse()
 
+	if *sign {
+		keyBytes, err := ioutil.ReadFile(*privateKeyFile)
+		if err != nil {
+			panic(err.Error())
+		}
+		privateKey := strings.TrimSpace(string(keyBytes))
+		pubkey, err := yt.PublicKeyOf(privateKey)
+		if err != nil {
+			panic(err.Error())
+		}
+		fmt.Printf("public key: %s\n", pubkey.String())
+		if *late {
+			if *chainID == "" {
+				panic("chain ID must be provided when signing late registration")
+			}
+			now := time.Now()
+			msg := &yt.LateRegMessage{Domain: *domain, ChainID: *chainID, Account: *inspAccount, IssuedAt: now.Unix(), Expiry: now.Add(*nonceTTL).Unix()}
+			sig, err := yt.SignLateRegistration(privateKey, msg)
+			if err != nil {
+				panic(err.Error())
+			}
+			req := &yt.LateRequest{Account: msg.Account, IssuedAt: msg.IssuedAt, Expiry: msg.Expiry, Sig: sig}
+			fmt.Printf("message:    %s\n", msg.Bytes())
+			fmt.Printf("signature:  %s\n", sig)
+			if *registryURL == "" {
+				body, _ := json.Marshal(req)
+				fmt.Printf("request:    %s\n", body)
+				return
+			}
+			balance, err := yt.NewRegistryClient(*registryURL).LateRegister(req)
+			if err != nil {
+				panic(err.Error())
+			}
+			fmt.Printf("added:      %s -> %d\n", *inspAccount, balance)
+			return
+		}
+		if *registryURL != "" {
+			req, err := yt.NewRegistryClient(*registryURL).SignAndRegister(privateKey, *inspAccount, *inspEthAddr)
+			if req != nil {
+				fmt.Printf("signature:  %s\n", req.Sig)
+			}
+			if err != nil {
+				panic(err.Error())
+			}
+			fmt.Printf("registered: %s -> %s\n", *inspAccount, *inspEthAddr)
+			return
+		}
+		if *chainID == "" {
+			panic("chain ID must be provided when signing offline")
+		}
+		msg := &yt.RegMessage{Domain: *domain, ChainID: *chainID, Account: *inspAccount, EthAddr: *inspEthAddr, Nonce: *inspNonce, IssuedAt: *inspIssuedAt, Expiry: *inspExpiry}
+		sig, err := yt.SignRegistration(privateKey, msg)
+		if err != nil {
+			panic(err.Error())
+		}
+		body, _ := json.Marshal(&yt.RegRequest{Account: msg.Account, EthAddr: msg.EthAddr, Nonce: msg.Nonce, IssuedAt: msg.IssuedAt, Expiry: msg.Expiry, Sig: sig})
+		fmt.Printf("message:    %s\n", msg.Bytes())
+		fmt.Printf("signature:  %s\n", sig)
+		fmt.Printf("request:    %s\n", body)
+		return
+	}
+
 	mgc, err := yt.NewInstance(*mongoURL)
 	if err != nil {
 		panic(err.Error())
@@ -50,134 +175,305 @@ func main() {
 		if err != nil {
 			panic(err.Error())
 		}
-		mgc.Snapshot(accounts, etx)
+		mgc.Snapshot(*snapshotID, accounts, etx)
 		return
 	}
 
-	if *daemon {
-		http.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-			vals := r.URL.Query()
-			if vals == nil || len(vals) == 0 || vals["account"] == nil || len(vals["account"]) == 0 || strings.TrimSpace(vals["account"][0]) == "" {
-				w.Write([]byte(formatJson(400, 0, "账号不能为空")))
-				return
-			}
-			account := vals["account"][0]
-			reg, err := mgc.GetAccountInfo(account)
+	if *diff {
+		if *diffFrom == *diffTo {
+			panic("snapshots to compare must be different")
+		}
+		result, err := mgc.DiffSnapshot(*diffFrom, *diffTo)
+		if err != nil {
+			panic(err.Error())
+		}
+		w := os.Stdout
+		if *out != "" {
+			w, err = os.Create(*out)
 			if err != nil {
-				if strings.Contains(err.Error(), "no documents in result") || strings.Contains(err.Error(), "resource not found") {
-					pubkey, err := etx.GetPubKey(account)
-					if err != nil {
-						w.Write([]byte(formatJson(400, 0, err.Error())))
-						fmt.Printf("!!! balance -> get account info error: %s\n", "账号不存在")
-						return
-					}
-					//balance, _ := etx.GetBalance(account)
-					err = mgc.AddRegistry(account, strings.TrimLeft(pubkey, "YTA"), 0)
-					if err != nil {
-						w.Write([]byte(formatJson(400, 0, err.Error())))
-						fmt.Printf("!!! balance -> get account info error: %s\n", "账号不存在")
-						return
-					}
-					w.Write([]byte(formatJson(0, 0, "请求成功")))
-					return
-				} else {
-					w.Write([]byte(formatJson(400, 0, err.Error())))
-					fmt.Printf("!!! balance -> get account info error: %s\n", err.Error())
-					return
-				}
-			}
-			if reg.Exclude {
-				w.Write([]byte(formatJson(400, 0, "账号不存在")))
-				return
+				panic(err.Error())
 			}
-			w.Write([]byte(formatJson(0, reg.Balance, "请求成功")))
+			defer w.Close()
+		}
+		err = result.WriteCSV(w)
+		if err != nil {
+			panic(err.Error())
+		}
+		log.Printf("snapshot diff %s -> %s: %d added, %d removed, %d changed, accounts %d -> %d, balance %d -> %d (%+d)\n", *diffFrom, *diffTo, len(result.Added), len(result.Removed), len(result.Changed), result.FromCount, result.ToCount, result.FromBalance, result.ToBalance, result.ToBalance-result.FromBalance)
+		return
+	}
+
+	if *export {
+		if *ethKeyFile == "" {
+			panic("Ethereum key file of operator must be provided")
+		}
+		privateKey, err := ecrypto.LoadECDSA(*ethKeyFile)
+		if err != nil {
+			panic(err.Error())
+		}
+		dist, err := mgc.GetDistribution()
+		if err != nil {
+			panic(err.Error())
+		}
+		manifest, err := dist.Export(*exportDir, privateKey)
+		if err != nil {
+			panic(err.Error())
+		}
+		log.Printf("distribution exported: %d entries, total %s, merkle root %s, signed by %s\n", manifest.Count, manifest.TokenTotal, manifest.MerkleRoot, manifest.Signer)
+		return
+	}
+
+	if *queuePayout {
+		dist, err := yt.LoadDistribution(filepath.Join(*exportDir, "distribution.json"))
+		if err != nil {
+			panic(err.Error())
+		}
+		queued, err := mgc.QueuePayout(dist)
+		if err != nil {
+			panic(err.Error())
+		}
+		log.Printf("payout queued: %d of %d entries, merkle root %s\n", queued, len(dist.Entries), dist.Tree.Root().Hex())
+		return
+	}
+
+	if *verifyAudit {
+		count, pending, err := mgc.VerifyAudit()
+		if err != nil {
+			log.Printf("audit log verification failed after %d entries: %s\n", count, err.Error())
+			os.Exit(1)
+		}
+		log.Printf("audit log is intact: %d entries\n", count)
+		if len(pending) > 0 {
+			log.Printf("!!! %d entries are still pending, check their mutations against registry: %v\n", len(pending), pending)
+		}
+		return
+	}
+
+	if *inspect {
+		msg := &yt.RegMessage{Domain: *domain, ChainID: resolveChainID(etx, *chainID), Account: *inspAccount, EthAddr: *inspEthAddr, Nonce: *inspNonce, IssuedAt: *inspIssuedAt, Expiry: *inspExpiry}
+		data, err := msg.SignedBytes(*inspSigType)
+		if err != nil {
+			panic(err.Error())
+		}
+		digest := sha256.Sum256(data)
+		if *inspSigType == yt.SigTypeESR {
+			esr, _ := msg.SigningRequest()
+			fmt.Printf("request:   %s\n", esr)
+			fmt.Printf("message:   %s\n", hex.EncodeToString(data))
+		} else {
+			fmt.Printf("message:   %s\n", data)
+		}
+		fmt.Printf("sha256:    %s\n", hex.EncodeToString(digest[:]))
+		if err := msg.Check(*domain, msg.ChainID, time.Now()); err != nil {
+			fmt.Printf("check:     %s\n", err.Error())
+		} else {
+			fmt.Printf("check:     ok\n")
+		}
+		recovered, err := yt.RecoverPublicKey(data, *inspSig)
+		if err != nil {
+			fmt.Printf("recovered: error: %s\n", err.Error())
+		} else {
+			fmt.Printf("recovered: %s\n", recovered.String())
+		}
+		reg, err := mgc.GetAccountInfo(*inspAccount)
+		if err != nil {
+			fmt.Printf("expected:  error: %s\n", err.Error())
 			return
-		})
+		}
+		expected, err := key.Parse(reg.Pubkey)
+		if err != nil {
+			fmt.Printf("expected:  %q (error: %s)\n", reg.Pubkey, err.Error())
+			return
+		}
+		fmt.Printf("expected:  %s\n", expected.String())
+		fmt.Printf("match:     %t\n", recovered != nil && recovered.Equal(expected))
+		return
+	}
 
-		http.HandleFunc("/ethaddr", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-			vals := r.URL.Query()
-			if vals == nil || len(vals) == 0 || vals["account"] == nil || len(vals["account"]) == 0 || strings.TrimSpace(vals["account"][0]) == "" {
-				w.Write([]byte(formatJson(400, 0, "账号不能为空")))
-				return
-			}
-			account := vals["account"][0]
-			reg, err := mgc.GetAccountInfo(account)
+	if *daemon {
+		if err := yt.CheckKeyPolicy(*keyPolicy); err != nil {
+			panic(err.Error())
+		}
+		regPolicy, err := yt.ParseRegPolicy(*regOpen, *regClose, *changeDeadline, *maxChanges)
+		if err != nil {
+			panic(err.Error())
+		}
+		proxies, err := server.ParseTrustedProxies(*trustedProxies)
+		if err != nil {
+			panic(err.Error())
+		}
+		config := &server.Config{
+			Domain:         *domain,
+			ChainID:        resolveChainID(etx, *chainID),
+			NonceTTL:       *nonceTTL,
+			RequireEthSig:  *requireEthSig,
+			KeyPolicy:      *keyPolicy,
+			RegPolicy:      regPolicy,
+			IPLimit:        server.RateLimit{Rate: *rateIP, Burst: *burstIP},
+			AccountLimit:   server.RateLimit{Rate: *rateAccount, Burst: *burstAccount},
+			ProxyHeader:    *proxyHeader,
+			TrustedProxies: proxies,
+			BatchLimit:     *batchMax,
+			MaxBodyBytes:   *maxBody,
+			EIP712Domain:   &yt.EIP712Domain{Name: *domain, Version: *eip712Version, ChainID: *ethChainID},
+		}
+		if *adminKeyFile != "" {
+			keyBytes, err := ioutil.ReadFile(*adminKeyFile)
 			if err != nil {
-				w.Write([]byte(formatJson(400, 0, err.Error())))
-				fmt.Printf("!!! ethaddr -> get account info error: %s\n", err.Error())
-				return
+				panic(err.Error())
 			}
-			w.Write([]byte(formatJson2(0, reg.EthAddr, "请求成功")))
-			return
-		})
-
-		http.HandleFunc("/reg", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-			s, err := ioutil.ReadAll(r.Body)
+			config.AdminAPIKey = strings.TrimSpace(string(keyBytes))
+		}
+		for _, pubkey := range strings.Split(*adminPubKeys, ",") {
+			if pubkey = strings.TrimSpace(pubkey); pubkey != "" {
+				config.AdminKeys = append(config.AdminKeys, key.MustParse(pubkey).String())
+			}
+		}
+		if *metricsTokenFile != "" {
+			tokenBytes, err := ioutil.ReadFile(*metricsTokenFile)
 			if err != nil {
-				w.Write([]byte(formatJson(500, 0, err.Error())))
-				return
+				panic(err.Error())
 			}
-			formData := new(Req)
-			err = json.NewDecoder(bytes.NewReader(s)).Decode(&formData)
+			config.MetricsToken = strings.TrimSpace(string(tokenBytes))
+		}
+		if *nonceKeyFile != "" {
+			keyBytes, err := ioutil.ReadFile(*nonceKeyFile)
 			if err != nil {
-				w.Write([]byte(formatJson(400, 0, "参数格式不正确")))
-				return
+				panic(err.Error())
 			}
-			account := formData.Account
-			if strings.Trim(account, " ") == "" {
-				w.Write([]byte(formatJson(400, 0, "账号不能为空")))
-				return
+			config.NonceKey = []byte(strings.TrimSpace(string(keyBytes)))
+		}
+		if *ethURL != "" {
+			ethClient, err := ethclient.Dial(*ethURL)
+			if err != nil {
+				panic(err.Error())
 			}
-			ethaddr := formData.EthAddr
-			if strings.Trim(ethaddr, " ") == "" {
-				w.Write([]byte(formatJson(400, 0, "ERC20钱包地址不能为空")))
-				return
+			config.EthCaller = ethClient
+		}
+		if *proofFile != "" {
+			dist, err := yt.LoadDistribution(*proofFile)
+			if err != nil {
+				panic(err.Error())
 			}
-			sig := formData.Sig
-			if strings.Trim(sig, " ") == "" {
-				w.Write([]byte(formatJson(400, 0, "签名不能为空")))
-				return
+			log.Printf("merkle distribution loaded: %d entries, total %s, merkle root %s\n", len(dist.Entries), dist.TokenTotal.String(), dist.Tree.Root().Hex())
+			config.Distribution = dist
+		}
+		if *late {
+			config.LatePolicy, err = yt.ParseLatePolicy(*lateCutoff, *lateExclude)
+			if err != nil {
+				panic(err.Error())
 			}
-			reg, err := mgc.GetAccountInfo(account)
+		}
+		handler := server.New(config, mgc, etx, server.SigVerifier{})
+		go handler.Probe(context.Background(), *probeInterval)
+		srv := &http.Server{
+			Addr:              fmt.Sprintf(":%d", *port),
+			Handler:           handler,
+			ReadHeaderTimeout: *readTimeout,
+			ReadTimeout:       *readTimeout,
+			WriteTimeout:      *writeTimeout,
+			IdleTimeout:       *idleTimeout,
+		}
+		var reloader *server.CertReloader
+		if *tlsCert != "" || *tlsKey != "" {
+			reloader, err = server.NewCertReloader(*tlsCert, *tlsKey)
 			if err != nil {
-				w.Write([]byte(formatJson(500, 0, err.Error())))
-				fmt.Printf("!!! reg -> get account info error: %s\n", err.Error())
-				return
+				panic(err.Error())
 			}
-			pubkey := reg.Pubkey
-			if ok := yt.Verify(pubkey, []byte(fmt.Sprintf("account=%s&ethaddr=%s", account, ethaddr)), sig); ok {
-				err = mgc.RegEthAddr(account, ethaddr)
-				if err != nil {
-					w.Write([]byte(formatJson(500, 0, err.Error())))
-					fmt.Printf("!!! reg -> RegEthAddr error: %s\n", err.Error())
-					return
-				}
-				w.Write([]byte(formatJson(0, 0, "ERC20地址注册成功")))
-				fmt.Printf("register eth address success: %s -> %s\n", account, ethaddr)
-				return
-			} else {
-				w.Write([]byte(formatJson(401, 0, "签名验证失败")))
-				fmt.Printf("!!! reg -> RegEthAddr error: %s\n", "签名验证失败")
-				return
+			srv.TLSConfig = &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12}
+		}
+		var metricsSrv *http.Server
+		if *metricsAddr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", handler.MetricsHandler())
+			metricsSrv = &http.Server{
+				Addr:              *metricsAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: *readTimeout,
+				ReadTimeout:       *readTimeout,
+				WriteTimeout:      *writeTimeout,
+				IdleTimeout:       *idleTimeout,
 			}
-		})
-		log.Printf(fmt.Sprintf("Server is listening on port %d\n", *port))
-		err = http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
-		if err != nil {
-			panic(err.Error())
 		}
+		serve(srv, metricsSrv, reloader, mgc, *shutdownTimeout)
 		return
 	}
 	flag.PrintDefaults()
 }
 
-func formatJson(code int, data int64, msg string) string {
-	return fmt.Sprintf("{\"code\":%d, \"data\": %d, \"msg\":\"%s\"}", code, data, msg)
+//mongoCloseTimeout max duration of closing MongoDB client after server is shut down
+const mongoCloseTimeout = 5 * time.Second
+
+//serve run srv and optional metricsSrv until SIGTERM or SIGINT, then drain in-flight requests and close MongoDB client,
+//TLS certificate of srv is reloaded on SIGHUP
+func serve(srv, metricsSrv *http.Server, reloader *server.CertReloader, mgc *yt.Mongoc, shutdownTimeout time.Duration) {
+	done := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGHUP {
+				if reloader == nil {
+					continue
+				}
+				if err := reloader.Reload(); err != nil {
+					log.Printf("!!! reload TLS certificate error: %s\n", err.Error())
+				} else {
+					log.Println("TLS certificate reloaded")
+				}
+				continue
+			}
+			log.Printf("%s received, shutting down\n", sig)
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Printf("!!! shutdown error: %s\n", err.Error())
+			}
+			if metricsSrv != nil {
+				if err := metricsSrv.Shutdown(ctx); err != nil {
+					log.Printf("!!! shutdown metrics server error: %s\n", err.Error())
+				}
+			}
+			cancel()
+			// shutdown may have used up its deadline, MongoDB client gets its own
+			ctx, cancel = context.WithTimeout(context.Background(), mongoCloseTimeout)
+			if err := mgc.Close(ctx); err != nil {
+				log.Printf("!!! close MongoDB client error: %s\n", err.Error())
+			}
+			cancel()
+			close(done)
+			return
+		}
+	}()
+	if metricsSrv != nil {
+		go func() {
+			log.Printf("Metrics server is listening on %s\n", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				panic(err.Error())
+			}
+		}()
+	}
+	var err error
+	if reloader != nil {
+		log.Printf("Server is listening on %s with TLS\n", srv.Addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Server is listening on %s\n", srv.Addr)
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		panic(err.Error())
+	}
+	<-done
+	log.Println("Server stopped")
 }
 
-func formatJson2(code int, data string, msg string) string {
-	return fmt.Sprintf("{\"code\":%d, \"data\": \"%s\", \"msg\":\"%s\"}", code, data, msg)
+func resolveChainID(etx *eostx.Eostx, chainID string) string {
+	if chainID != "" {
+		return chainID
+	}
+	info, err := etx.API.GetInfo()
+	if err != nil {
+		panic(err.Error())
+	}
+	return info.ChainID.String()
 }
@@ -0,0 +1,70 @@
+package ytttransfer
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	ecrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	eip712DomainType    = "EIP712Domain(string name,string version,uint256 chainId)"
+	registerEthAddrType = "RegisterEthAddr(string account,address ethaddr,string nonce,uint256 deadline)"
+)
+
+//EIP712Domain domain of EIP-712 typed registration data
+type EIP712Domain struct {
+	Name    string
+	Version string
+	ChainID int64
+}
+
+//Separator EIP-712 domain separator
+func (domain *EIP712Domain) Separator() []byte {
+	return ecrypto.Keccak256(
+		ecrypto.Keccak256([]byte(eip712DomainType)),
+		ecrypto.Keccak256([]byte(domain.Name)),
+		ecrypto.Keccak256([]byte(domain.Version)),
+		math.PaddedBigBytes(big.NewInt(domain.ChainID), 32),
+	)
+}
+
+//Hash EIP-712 signing hash of registration message, expiry of message is used as deadline
+func (domain *EIP712Domain) Hash(msg *RegMessage) []byte {
+	structHash := ecrypto.Keccak256(
+		ecrypto.Keccak256([]byte(registerEthAddrType)),
+		ecrypto.Keccak256([]byte(msg.Account)),
+		common.LeftPadBytes(common.HexToAddress(msg.EthAddr).Bytes(), 32),
+		ecrypto.Keccak256([]byte(msg.Nonce)),
+		math.PaddedBigBytes(big.NewInt(msg.Expiry), 32),
+	)
+	return ecrypto.Keccak256([]byte{0x19, 0x01}, domain.Separator(), structHash)
+}
+
+//TypedData registration message in the JSON form of eth_signTypedData_v4
+func (domain *EIP712Domain) TypedData(msg *RegMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"types": map[string]interface{}{
+			"EIP712Domain": []map[string]string{
+				{"name": "name", "type": "string"},
+				{"name": "version", "type": "string"},
+				{"name": "chainId", "type": "uint256"},
+			},
+			"RegisterEthAddr": []map[string]string{
+				{"name": "account", "type": "string"},
+				{"name": "ethaddr", "type": "address"},
+				{"name": "nonce", "type": "string"},
+				{"name": "deadline", "type": "uint256"},
+			},
+		},
+		"primaryType": "RegisterEthAddr",
+		"domain":      map[string]interface{}{"name": domain.Name, "version": domain.Version, "chainId": domain.ChainID},
+		"message":     map[string]interface{}{"account": msg.Account, "ethaddr": msg.EthAddr, "nonce": msg.Nonce, "deadline": msg.Expiry},
+	}
+}
+
+//VerifyEthTypedData verify EIP-712 signature of registration message by its ERC20 address
+func VerifyEthTypedData(domain *EIP712Domain, msg *RegMessage, signature string) bool {
+	return verifyEthHash(msg.EthAddr, domain.Hash(msg), signature)
+}
@@ -0,0 +1,43 @@
+package ytttransfer
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+//testTypedSig eth_signTypedData_v4 of testRegMessage by testEthAddr in testEIP712Domain
+const testTypedSig = "0xd9feb5b0f644acfda136170d68434dacc386c082d157dba5e77fc02b8268c5661b7ec532abced59c41f4489381f36477d7f3325c214bb1dd6f77b00e007297f41c"
+
+var testEIP712Domain = &EIP712Domain{Name: "ytttransfer", Version: "1", ChainID: 1}
+
+func TestEIP712Hash(t *testing.T) {
+	// computed independently as keccak256 of the encoded domain and struct
+	if got := hex.EncodeToString(testEIP712Domain.Separator()); got != "bac718ca3682ec717b3d954a79d93c52244aea833ee6313a4ee9d1095c93573d" {
+		t.Errorf("domain separator is %s", got)
+	}
+	if got := hex.EncodeToString(testEIP712Domain.Hash(testRegMessage())); got != "e38063a87993f660ae529ac37caa11e4391ad8531bb389ffcda087a5997cb7ba" {
+		t.Errorf("hash is %s", got)
+	}
+	other := *testEIP712Domain
+	other.ChainID = 3
+	if hex.EncodeToString(other.Hash(testRegMessage())) == "e38063a87993f660ae529ac37caa11e4391ad8531bb389ffcda087a5997cb7ba" {
+		t.Error("hash does not depend on chain ID")
+	}
+}
+
+func TestVerifyEthTypedData(t *testing.T) {
+	if !VerifyEthTypedData(testEIP712Domain, testRegMessage(), testTypedSig) {
+		t.Fatal("valid signature is rejected")
+	}
+	msg := testRegMessage()
+	msg.Nonce = "01"
+	if VerifyEthTypedData(testEIP712Domain, msg, testTypedSig) {
+		t.Fatal("signature of another nonce is accepted")
+	}
+	if VerifyEthTypedData(&EIP712Domain{Name: "ytttransfer", Version: "2", ChainID: 1}, testRegMessage(), testTypedSig) {
+		t.Fatal("signature of another domain is accepted")
+	}
+	if VerifyEthTypedData(testEIP712Domain, testRegMessage(), testEthSig) {
+		t.Fatal("personal_sign signature is accepted as typed data")
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	eos "github.com/eoscanada/eos-go"
 	_ "github.com/eoscanada/eos-go/system"
 	_ "github.com/eoscanada/eos-go/token"
 )
 
+//ErrNoBalance account has no YTT balance
+var ErrNoBalance = errors.New("no YTT balance")
+
 type Eostx struct {
 	API *eos.API
 }
@@ -72,7 +76,7 @@ func (api *Eostx) GetBalance(account string) (int64, error) {
 			return int64(a.Amount), nil
 		}
 	}
-	return 0, errors.New("no YTT balance")
+	return 0, ErrNoBalance
 }
 
 func (api *Eostx) GetPubKey(account string) (string, error) {
@@ -94,3 +98,19 @@ func (api *Eostx) GetPubKey(account string) (string, error) {
 	}
 	return "", errors.New("no valid public key")
 }
+
+//GetCreated get creation time of account
+func (api *Eostx) GetCreated(account string) (time.Time, error) {
+	resp := new(AccountResp)
+	err := api.API.Call("chain", "get_account", M{"account_name": eos.AN(account)}, resp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return resp.Created.Time, nil
+}
+
+//Ping check EOS node is reachable by get_info
+func (api *Eostx) Ping() error {
+	_, err := api.API.GetInfo()
+	return err
+}
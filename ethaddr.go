@@ -0,0 +1,61 @@
+package ytttransfer
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var ethAddrRegex = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+var (
+	//ErrEthAddrFormat ethaddr is not 0x followed by 40 hex characters
+	ErrEthAddrFormat = errors.New("ERC20 address must be 0x followed by 40 hex characters")
+	//ErrEthAddrChecksum mixed-case ethaddr does not match its EIP-55 checksum
+	ErrEthAddrChecksum = errors.New("ERC20 address EIP-55 checksum mismatch")
+	//ErrEthAddrZero ethaddr is the zero address
+	ErrEthAddrZero = errors.New("ERC20 address is the zero address")
+	//ErrEthAddrBurn ethaddr is a well-known burn address
+	ErrEthAddrBurn = errors.New("ERC20 address is a burn address")
+)
+
+//BurnAddresses well-known addresses nobody controls
+var BurnAddresses = map[common.Address]bool{
+	common.HexToAddress("0x000000000000000000000000000000000000dEaD"): true,
+	common.HexToAddress("0xdEAD000000000000000042069420694206942069"): true,
+	common.HexToAddress("0x0000000000000000000000000000000000000001"): true,
+	common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"): true,
+}
+
+//ValidateEthAddr validate hex format and EIP-55 checksum of ethaddr and reject the zero address and burn addresses,
+//all-lowercase or all-uppercase addresses carry no checksum and are accepted
+func ValidateEthAddr(ethaddr string) (common.Address, error) {
+	if !ethAddrRegex.MatchString(ethaddr) {
+		return common.Address{}, ErrEthAddrFormat
+	}
+	addr := common.HexToAddress(ethaddr)
+	hexPart := ethaddr[2:]
+	if hexPart != strings.ToLower(hexPart) && hexPart != strings.ToUpper(hexPart) && ethaddr != addr.Hex() {
+		return common.Address{}, ErrEthAddrChecksum
+	}
+	if addr == (common.Address{}) {
+		return common.Address{}, ErrEthAddrZero
+	}
+	if BurnAddresses[addr] {
+		return common.Address{}, ErrEthAddrBurn
+	}
+	return addr, nil
+}
+
+//IsContract check whether there is contract code at ethaddr in the latest block
+func IsContract(ctx context.Context, caller bind.ContractCaller, ethaddr common.Address) (bool, error) {
+	code, err := caller.CodeAt(ctx, ethaddr, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(code) > 0, nil
+}
@@ -0,0 +1,275 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ecrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	//YTTPrecision decimals of YTT balances stored in registry
+	YTTPrecision = 4
+	//ERC20Decimals decimals of the ERC20 token paid out
+	ERC20Decimals = 18
+)
+
+//DistributionEntry one payout of the final distribution
+type DistributionEntry struct {
+	Index   uint64         `json:"index"`
+	Account string         `json:"account"`
+	EthAddr common.Address `json:"ethaddr"`
+	Amount  *big.Int       `json:"amount"`
+}
+
+//MarshalJSON encode amount as decimal string so that JSON consumers keep full precision
+func (e *DistributionEntry) MarshalJSON() ([]byte, error) {
+	type entry DistributionEntry
+	return json.Marshal(&struct {
+		*entry
+		Amount string `json:"amount"`
+	}{(*entry)(e), e.Amount.String()})
+}
+
+//Distribution final list of payouts and the merkle tree built over them
+type Distribution struct {
+	Entries    []*DistributionEntry
+	TokenTotal *big.Int
+	Tree       *MerkleTree
+	byEthAddr  map[common.Address][]*DistributionEntry
+}
+
+//UnmarshalJSON decode amount from decimal string
+func (e *DistributionEntry) UnmarshalJSON(b []byte) error {
+	type entry DistributionEntry
+	v := &struct {
+		*entry
+		Amount string `json:"amount"`
+	}{entry: (*entry)(e)}
+	err := json.Unmarshal(b, v)
+	if err != nil {
+		return err
+	}
+	amount, ok := new(big.Int).SetString(v.Amount, 10)
+	if !ok || amount.Sign() < 0 {
+		return fmt.Errorf("invalid amount: %q", v.Amount)
+	}
+	e.Amount = amount
+	return nil
+}
+
+//MerkleClaim everything needed to claim one entry from the distributor contract
+type MerkleClaim struct {
+	Index   uint64         `json:"index"`
+	Account string         `json:"account"`
+	EthAddr common.Address `json:"ethaddr"`
+	Amount  string         `json:"amount"`
+	Proof   []common.Hash  `json:"proof"`
+}
+
+//Manifest summary of an exported distribution signed by the operator
+type Manifest struct {
+	MerkleRoot string `json:"merkleRoot"`
+	TokenTotal string `json:"tokenTotal"`
+	Count      int    `json:"count"`
+	CSVSha256  string `json:"csvSha256"`
+	JSONSha256 string `json:"jsonSha256"`
+	Signer     string `json:"signer"`
+	Signature  string `json:"signature"`
+}
+
+//ToERC20Amount convert YTT balance to the amount of ERC20 token in its smallest unit
+func ToERC20Amount(balance int64) *big.Int {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(ERC20Decimals-YTTPrecision), nil)
+	return new(big.Int).Mul(big.NewInt(balance), scale)
+}
+
+//ToYTTBalance convert amount of ERC20 token in its smallest unit back to YTT balance, false if amount is not a whole YTT balance
+func ToYTTBalance(amount *big.Int) (int64, bool) {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(ERC20Decimals-YTTPrecision), nil)
+	balance, rem := new(big.Int).QuoRem(amount, scale, new(big.Int))
+	if amount.Sign() < 0 || rem.Sign() != 0 || !balance.IsInt64() {
+		return 0, false
+	}
+	return balance.Int64(), true
+}
+
+//NewDistribution build the distribution from registry, excluded accounts and accounts without ERC20 address or balance are skipped,
+//entries are sorted by account name and indexed in that order
+func NewDistribution(regs []*Registry) *Distribution {
+	sorted := make([]*Registry, 0, len(regs))
+	for _, reg := range regs {
+		if reg.Exclude || reg.EthAddr == "" || reg.Balance <= 0 {
+			continue
+		}
+		if _, err := ValidateEthAddr(reg.EthAddr); err != nil {
+			log.Printf("!!! skip invalid ethaddr in distribution: %s -> %s : %s\n", reg.Account, reg.EthAddr, err.Error())
+			continue
+		}
+		sorted = append(sorted, reg)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Account < sorted[j].Account })
+	entries := make([]*DistributionEntry, 0, len(sorted))
+	for i, reg := range sorted {
+		entries = append(entries, &DistributionEntry{Index: uint64(i), Account: reg.Account, EthAddr: common.HexToAddress(reg.EthAddr), Amount: ToERC20Amount(reg.Balance)})
+	}
+	return newDistribution(entries)
+}
+
+//newDistribution build token total, merkle tree and address index over entries
+func newDistribution(entries []*DistributionEntry) *Distribution {
+	dist := &Distribution{Entries: entries, TokenTotal: new(big.Int), byEthAddr: make(map[common.Address][]*DistributionEntry)}
+	leaves := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		dist.TokenTotal.Add(dist.TokenTotal, entry.Amount)
+		dist.byEthAddr[entry.EthAddr] = append(dist.byEthAddr[entry.EthAddr], entry)
+		leaves = append(leaves, MerkleLeaf(entry.Index, entry.EthAddr, entry.Amount))
+	}
+	dist.Tree = NewMerkleTree(leaves)
+	return dist
+}
+
+//LoadDistribution load the frozen distribution from distribution.json written by Export,
+//the merkle tree is rebuilt from its entries and must match the published merkle root and token total
+func LoadDistribution(path string) (*Distribution, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := new(struct {
+		MerkleRoot common.Hash          `json:"merkleRoot"`
+		TokenTotal string               `json:"tokenTotal"`
+		Entries    []*DistributionEntry `json:"entries"`
+	})
+	err = json.Unmarshal(b, file)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range file.Entries {
+		if e.Index != uint64(i) || e.Amount == nil {
+			return nil, fmt.Errorf("invalid entry %d of distribution", i)
+		}
+	}
+	dist := newDistribution(file.Entries)
+	if dist.Tree.Root() != file.MerkleRoot {
+		return nil, fmt.Errorf("merkle root mismatch: %s is published, %s is built", file.MerkleRoot.Hex(), dist.Tree.Root().Hex())
+	}
+	if dist.TokenTotal.String() != file.TokenTotal {
+		return nil, fmt.Errorf("token total mismatch: %s is published, %s is built", file.TokenTotal, dist.TokenTotal.String())
+	}
+	return dist, nil
+}
+
+//GetDistribution build the distribution from current registry
+func (client *Mongoc) GetDistribution() (*Distribution, error) {
+	regs, err := client.GetRegistries()
+	if err != nil {
+		return nil, err
+	}
+	return NewDistribution(regs), nil
+}
+
+//Claims list claims with merkle proofs of all entries paid to ethaddr
+func (dist *Distribution) Claims(ethaddr common.Address) ([]*MerkleClaim, error) {
+	claims := make([]*MerkleClaim, 0)
+	for _, e := range dist.byEthAddr[ethaddr] {
+		proof, err := dist.Tree.Proof(MerkleLeaf(e.Index, e.EthAddr, e.Amount))
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, &MerkleClaim{Index: e.Index, Account: e.Account, EthAddr: e.EthAddr, Amount: e.Amount.String(), Proof: proof})
+	}
+	return claims, nil
+}
+
+//CSV canonical CSV encoding of the distribution
+func (dist *Distribution) CSV() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	cw := csv.NewWriter(buf)
+	records := [][]string{{"index", "account", "ethaddr", "amount"}}
+	for _, e := range dist.Entries {
+		records = append(records, []string{strconv.FormatUint(e.Index, 10), e.Account, e.EthAddr.Hex(), e.Amount.String()})
+	}
+	err := cw.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//JSON canonical JSON encoding of the distribution
+func (dist *Distribution) JSON() ([]byte, error) {
+	return json.MarshalIndent(map[string]interface{}{
+		"merkleRoot": dist.Tree.Root().Hex(),
+		"tokenTotal": dist.TokenTotal.String(),
+		"entries":    dist.Entries,
+	}, "", "  ")
+}
+
+//Message text signed by the operator for this manifest
+func (m *Manifest) Message() []byte {
+	return []byte(fmt.Sprintf("merkleRoot=%s&tokenTotal=%s&count=%d&csvSha256=%s&jsonSha256=%s", m.MerkleRoot, m.TokenTotal, m.Count, m.CSVSha256, m.JSONSha256))
+}
+
+//Sign sign the manifest by EIP-191 personal_sign with operator's Ethereum key
+func (m *Manifest) Sign(privateKey *ecdsa.PrivateKey) error {
+	sig, err := ecrypto.Sign(accounts.TextHash(m.Message()), privateKey)
+	if err != nil {
+		return err
+	}
+	sig[64] += 27
+	m.Signer = ecrypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+	m.Signature = hexutil.Encode(sig)
+	return nil
+}
+
+//Export write distribution.csv, distribution.json and the signed manifest.json to dir
+func (dist *Distribution) Export(dir string, privateKey *ecdsa.PrivateKey) (*Manifest, error) {
+	csvBytes, err := dist.CSV()
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := dist.JSON()
+	if err != nil {
+		return nil, err
+	}
+	csvSum := sha256.Sum256(csvBytes)
+	jsonSum := sha256.Sum256(jsonBytes)
+	manifest := &Manifest{
+		MerkleRoot: dist.Tree.Root().Hex(),
+		TokenTotal: dist.TokenTotal.String(),
+		Count:      len(dist.Entries),
+		CSVSha256:  hex.EncodeToString(csvSum[:]),
+		JSONSha256: hex.EncodeToString(jsonSum[:]),
+	}
+	err = manifest.Sign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{"distribution.csv": csvBytes, "distribution.json": jsonBytes, "manifest.json": manifestBytes}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), content, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,21 @@
+package ytttransfer
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestToYTTBalance(t *testing.T) {
+	for _, balance := range []int64{0, 1, 12345, 1<<63 - 1} {
+		got, ok := ToYTTBalance(ToERC20Amount(balance))
+		if !ok || got != balance {
+			t.Fatalf("balance of %d is %d %t", balance, got, ok)
+		}
+	}
+	over := new(big.Int).Mul(big.NewInt(1<<62), big.NewInt(4))
+	for _, amount := range []*big.Int{big.NewInt(1), big.NewInt(-1), new(big.Int).Add(ToERC20Amount(5), big.NewInt(1)), new(big.Int).Mul(over, ToERC20Amount(1))} {
+		if got, ok := ToYTTBalance(amount); ok {
+			t.Fatalf("amount %s is accepted as %d", amount, got)
+		}
+	}
+}
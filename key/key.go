@@ -0,0 +1,143 @@
+package key
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+//Curve elliptic curve of a public key
+type Curve int
+
+const (
+	//K1 secp256k1
+	K1 Curve = iota
+	//R1 secp256r1
+	R1
+)
+
+//LegacyPrefixes chain prefixes accepted in front of legacy public keys
+var LegacyPrefixes = []string{"EOS", "YTA"}
+
+var (
+	//ErrBadPrefix public key has unknown prefix
+	ErrBadPrefix = errors.New("unknown public key prefix")
+	//ErrBadEncoding key is not valid base58
+	ErrBadEncoding = errors.New("key is not valid base58")
+	//ErrBadLength decoded key has wrong length
+	ErrBadLength = errors.New("invalid key length")
+	//ErrBadChecksum checksum of key mismatch
+	ErrBadChecksum = errors.New("key checksum mismatch")
+)
+
+//String name of curve used in key prefixes
+func (c Curve) String() string {
+	switch c {
+	case K1:
+		return "K1"
+	case R1:
+		return "R1"
+	default:
+		return fmt.Sprintf("Curve(%d)", int(c))
+	}
+}
+
+//PublicKey EOSIO public key with its curve and compressed point
+type PublicKey struct {
+	Curve Curve
+	Data  []byte
+}
+
+//New create public key from compressed point of curve
+func New(curve Curve, data []byte) (*PublicKey, error) {
+	if len(data) != 33 || (data[0] != 0x02 && data[0] != 0x03) {
+		return nil, ErrBadLength
+	}
+	return &PublicKey{Curve: curve, Data: append([]byte{}, data...)}, nil
+}
+
+//Parse parse public key in any of the following formats:
+//PUB_K1_<base58>, PUB_R1_<base58>, EOS<base58>, YTA<base58>, or legacy <base58> whose chain prefix has been stripped
+func Parse(s string) (*PublicKey, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "PUB_K1_"):
+		return decode(K1, strings.TrimPrefix(s, "PUB_K1_"), "K1")
+	case strings.HasPrefix(s, "PUB_R1_"):
+		return decode(R1, strings.TrimPrefix(s, "PUB_R1_"), "R1")
+	case strings.HasPrefix(s, "PUB_"):
+		return nil, ErrBadPrefix
+	}
+	for _, prefix := range LegacyPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			// a stripped legacy key may begin with the same letters, so try the prefixed form first
+			if k, err := decode(K1, strings.TrimPrefix(s, prefix), ""); err == nil {
+				return k, nil
+			}
+		}
+	}
+	return decode(K1, s, "")
+}
+
+//MustParse parse public key or panic
+func MustParse(s string) *PublicKey {
+	k, err := Parse(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return k
+}
+
+//Canonical parse public key and return its canonical form
+func Canonical(s string) (string, error) {
+	k, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return k.String(), nil
+}
+
+//String canonical form of public key: PUB_K1_<base58> or PUB_R1_<base58>
+func (k *PublicKey) String() string {
+	suffix := k.Curve.String()
+	return "PUB_" + suffix + "_" + base58.Encode(append(append([]byte{}, k.Data...), Checksum(k.Data, suffix)...))
+}
+
+//Legacy legacy form of K1 public key with chain prefix, e.g. EOS<base58> or YTA<base58>
+func (k *PublicKey) Legacy(prefix string) (string, error) {
+	if k.Curve != K1 {
+		return "", fmt.Errorf("%s public key has no legacy form", k.Curve)
+	}
+	return prefix + base58.Encode(append(append([]byte{}, k.Data...), Checksum(k.Data, "")...)), nil
+}
+
+//Equal check whether two public keys are the same
+func (k *PublicKey) Equal(other *PublicKey) bool {
+	return other != nil && k.Curve == other.Curve && bytes.Equal(k.Data, other.Data)
+}
+
+func decode(curve Curve, s string, suffix string) (*PublicKey, error) {
+	raw, err := base58.Decode(s)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrBadEncoding
+	}
+	if len(raw) != 37 {
+		return nil, ErrBadLength
+	}
+	if !bytes.Equal(raw[33:], Checksum(raw[0:33], suffix)) {
+		return nil, ErrBadChecksum
+	}
+	return New(curve, raw[0:33])
+}
+
+//Checksum EOSIO checksum: first 4 bytes of ripemd160(data + suffix), suffix is empty for legacy keys
+func Checksum(data []byte, suffix string) []byte {
+	h := ripemd160.New()
+	h.Write(data)
+	h.Write([]byte(suffix))
+	return h.Sum(nil)[0:4]
+}
@@ -0,0 +1,83 @@
+package key
+
+import (
+	"math/rand"
+	"testing"
+)
+
+//randomKey random compressed point which need not be on curve, checksums do not care
+func randomKey(r *rand.Rand, curve Curve) *PublicKey {
+	data := make([]byte, 33)
+	r.Read(data)
+	data[0] = 0x02 + byte(r.Intn(2))
+	k, err := New(curve, data)
+	if err != nil {
+		panic(err.Error())
+	}
+	return k
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		for _, curve := range []Curve{K1, R1} {
+			k := randomKey(r, curve)
+			again, err := Parse(k.String())
+			if err != nil || !again.Equal(k) {
+				t.Fatalf("%s does not round trip: %v", k, err)
+			}
+			if curve != K1 {
+				if _, err := k.Legacy("EOS"); err == nil {
+					t.Fatalf("%s has legacy form", k)
+				}
+				continue
+			}
+			for _, prefix := range append(LegacyPrefixes, "") {
+				legacy, err := k.Legacy(prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				again, err := Parse(legacy)
+				if err != nil || !again.Equal(k) {
+					t.Fatalf("%s does not round trip: %v", legacy, err)
+				}
+			}
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 100; i++ {
+		k := randomKey(r, K1)
+		// K1 checksum is not the legacy checksum, so swapping prefixes must fail
+		legacy, _ := k.Legacy("")
+		if _, err := Parse("PUB_K1_" + legacy); err != ErrBadChecksum {
+			t.Fatalf("PUB_K1_%s: got %v, want %v", legacy, err, ErrBadChecksum)
+		}
+		if _, err := Parse("PUB_R1_" + k.String()[len("PUB_K1_"):]); err != ErrBadChecksum {
+			t.Fatalf("%s as R1: got %v, want %v", k, err, ErrBadChecksum)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := "PUB_K1_79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHWykZkr"
+	cases := []struct {
+		in  string
+		err error
+	}{
+		{"PUB_X1_79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHWykZkr", ErrBadPrefix},
+		{"PUB_K1_0OIl", ErrBadEncoding},
+		{"PUB_K1_", ErrBadEncoding},
+		{valid[:len(valid)-4], ErrBadLength},
+		{valid[:len(valid)-1] + "s", ErrBadChecksum},
+		{"YTA79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHZUYw3o", nil},
+		{valid, nil},
+	}
+	for _, c := range cases {
+		if _, err := Parse(c.in); err != c.err {
+			t.Errorf("Parse(%q) = %v, want %v", c.in, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package key
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+
+	"github.com/mr-tron/base58"
+)
+
+//ErrUnsupportedPrivateKey private key is neither legacy WIF nor PVT_K1_
+var ErrUnsupportedPrivateKey = errors.New("only legacy WIF and PVT_K1_ private keys are supported")
+
+//ParsePrivate parse K1 private key in legacy WIF or PVT_K1_<base58> format, returns the 32 bytes secret
+func ParsePrivate(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "PVT_K1_") {
+		raw, err := base58.Decode(strings.TrimPrefix(s, "PVT_K1_"))
+		if err != nil || len(raw) == 0 {
+			return nil, ErrBadEncoding
+		}
+		if len(raw) != 36 {
+			return nil, ErrBadLength
+		}
+		if !bytes.Equal(raw[32:], Checksum(raw[0:32], "K1")) {
+			return nil, ErrBadChecksum
+		}
+		return raw[0:32], nil
+	}
+	if strings.HasPrefix(s, "PVT_") {
+		return nil, ErrUnsupportedPrivateKey
+	}
+	raw, err := base58.Decode(s)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrBadEncoding
+	}
+	// 0x80 + secret + optional 0x01 compression flag + 4 bytes double sha256 checksum
+	if (len(raw) != 37 && len(raw) != 38) || raw[0] != 0x80 || (len(raw) == 38 && raw[33] != 0x01) {
+		return nil, ErrBadLength
+	}
+	payload := raw[0 : len(raw)-4]
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	if !bytes.Equal(raw[len(raw)-4:], h2[0:4]) {
+		return nil, ErrBadChecksum
+	}
+	return raw[1:33], nil
+}
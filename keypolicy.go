@@ -0,0 +1,53 @@
+package ytttransfer
+
+import "fmt"
+
+const (
+	//KeyPolicySnapshot registration must be signed by the key captured in snapshot
+	KeyPolicySnapshot = "snapshot"
+	//KeyPolicyChain registration must be signed by the current active key on chain
+	KeyPolicyChain = "chain"
+	//KeyPolicyBoth snapshot key and current active key on chain must be the same key which signed the registration
+	KeyPolicyBoth = "both"
+)
+
+//KeyDecision result of checking a registration signature against key policy, recorded with the registration
+type KeyDecision struct {
+	Policy      string `json:"policy"`
+	SnapshotKey string `json:"snapshotKey"`
+	ChainKey    string `json:"chainKey"`
+	SnapshotOK  bool   `json:"snapshotOk"`
+	ChainOK     bool   `json:"chainOk"`
+	Accepted    bool   `json:"accepted"`
+}
+
+//CheckKeyPolicy check whether policy is supported
+func CheckKeyPolicy(policy string) error {
+	switch policy {
+	case KeyPolicySnapshot, KeyPolicyChain, KeyPolicyBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown key policy: %s", policy)
+	}
+}
+
+//DecideKey verify the registration by snapshot key and/or chain key as required by policy,
+//verify is called with each public key to check, chainKey is only used by chain and both policies
+func DecideKey(policy, snapshotKey, chainKey string, verify func(publicKey string) bool) *KeyDecision {
+	decision := &KeyDecision{Policy: policy, SnapshotKey: snapshotKey, ChainKey: chainKey}
+	if policy != KeyPolicyChain && snapshotKey != "" {
+		decision.SnapshotOK = verify(snapshotKey)
+	}
+	if policy != KeyPolicySnapshot && chainKey != "" {
+		decision.ChainOK = verify(chainKey)
+	}
+	switch policy {
+	case KeyPolicySnapshot:
+		decision.Accepted = decision.SnapshotOK
+	case KeyPolicyChain:
+		decision.Accepted = decision.ChainOK
+	case KeyPolicyBoth:
+		decision.Accepted = decision.SnapshotOK && decision.ChainOK
+	}
+	return decision
+}
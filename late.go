@@ -0,0 +1,97 @@
+package ytttransfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	//ErrLateExcluded account is excluded from late registration
+	ErrLateExcluded = errors.New("account is excluded from late registration")
+	//ErrLateCutoff account is created after cutoff of late registration
+	ErrLateCutoff = errors.New("account is created after cutoff of late registration")
+	//ErrAlreadyInRegistry account is already in registry
+	ErrAlreadyInRegistry = errors.New("account is already in registry")
+)
+
+//LateRegMessage payload signed by current active key of an EOS account which is missing from snapshot to add itself to registry
+type LateRegMessage struct {
+	Domain   string `json:"domain"`
+	ChainID  string `json:"chainId"`
+	Account  string `json:"account"`
+	IssuedAt int64  `json:"issuedAt"`
+	Expiry   int64  `json:"expiry"`
+}
+
+//Bytes canonical text of late registration message which is hashed and signed
+func (msg *LateRegMessage) Bytes() []byte {
+	return []byte(fmt.Sprintf("action=late&domain=%s&chainId=%s&account=%s&issuedAt=%d&expiry=%d", msg.Domain, msg.ChainID, msg.Account, msg.IssuedAt, msg.Expiry))
+}
+
+//Check check domain separation fields and validity period of late registration message,
+//replaying it is harmless since an account can only be added once
+func (msg *LateRegMessage) Check(domain, chainID string, now time.Time) error {
+	if msg.Domain != domain {
+		return fmt.Errorf("domain mismatch: %s", msg.Domain)
+	}
+	if msg.ChainID != chainID {
+		return fmt.Errorf("chain id mismatch: %s", msg.ChainID)
+	}
+	return checkPeriod(msg.IssuedAt, msg.Expiry, now)
+}
+
+//LatePolicy exclusion and cutoff policy of late registrations
+type LatePolicy struct {
+	Cutoff  time.Time // accounts created after cutoff cannot register late, no limit if zero
+	Exclude []string  // excluded accounts, an entry ending with * excludes all accounts with that prefix
+}
+
+//ParseLatePolicy parse cutoff in RFC 3339 format (empty for no cutoff) and comma separated excluded accounts
+func ParseLatePolicy(cutoff, exclude string) (*LatePolicy, error) {
+	t, err := parseOptionalTime(cutoff)
+	if err != nil {
+		return nil, err
+	}
+	policy := &LatePolicy{Cutoff: t}
+	for _, account := range strings.Split(exclude, ",") {
+		if account = strings.TrimSpace(account); account != "" {
+			policy.Exclude = append(policy.Exclude, account)
+		}
+	}
+	return policy, nil
+}
+
+//Check check whether account created at given time may register late
+func (policy *LatePolicy) Check(account string, created time.Time) error {
+	for _, e := range policy.Exclude {
+		if account == e || (strings.HasSuffix(e, "*") && strings.HasPrefix(account, strings.TrimSuffix(e, "*"))) {
+			return ErrLateExcluded
+		}
+	}
+	if !policy.Cutoff.IsZero() && created.After(policy.Cutoff) {
+		return ErrLateCutoff
+	}
+	return nil
+}
+
+//AddLateRegistry add an account missing from snapshot to registry and record it is added after snapshot,
+//returns ErrAlreadyInRegistry if account exists
+func (client *Mongoc) AddLateRegistry(account, pubkey string, balance int64, origin *Origin) error {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	return client.Audit(AuditLate, account, bson.M{"pubkey": pubkey, "balance": balance}, origin, func() error {
+		_, err := collection.InsertOne(context.Background(), bson.M{"_id": account, "pubkey": pubkey, "balance": balance, "ethaddr": "", "exclude": false, "late": true, "addedat": time.Now().Unix()})
+		if err != nil {
+			if strings.Contains(err.Error(), "duplicate key") {
+				return ErrAlreadyInRegistry
+			}
+			log.Printf("!!! error when add late registry: %s -> %s\n", account, err.Error())
+		}
+		return err
+	})
+}
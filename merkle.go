@@ -0,0 +1,100 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	ecrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+//MerkleTree keccak256 merkle tree with sorted pair hashing, compatible with Uniswap's MerkleDistributor contract
+type MerkleTree struct {
+	layers [][][]byte
+}
+
+//MerkleLeaf build the leaf of one claim: keccak256(abi.encodePacked(uint256 index, address account, uint256 amount))
+func MerkleLeaf(index uint64, ethaddr common.Address, amount *big.Int) []byte {
+	return ecrypto.Keccak256(
+		math.PaddedBigBytes(new(big.Int).SetUint64(index), 32),
+		ethaddr.Bytes(),
+		math.PaddedBigBytes(amount, 32),
+	)
+}
+
+//NewMerkleTree build a merkle tree from leaves, leaves are sorted and deduplicated before building
+func NewMerkleTree(leaves [][]byte) *MerkleTree {
+	elements := append([][]byte{}, leaves...)
+	sort.Slice(elements, func(i, j int) bool { return bytes.Compare(elements[i], elements[j]) < 0 })
+	dedup := make([][]byte, 0, len(elements))
+	for i, e := range elements {
+		if i == 0 || !bytes.Equal(e, elements[i-1]) {
+			dedup = append(dedup, e)
+		}
+	}
+	tree := &MerkleTree{layers: [][][]byte{dedup}}
+	for len(tree.layers[len(tree.layers)-1]) > 1 {
+		layer := tree.layers[len(tree.layers)-1]
+		next := make([][]byte, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				next = append(next, layer[i])
+			} else {
+				next = append(next, combinedHash(layer[i], layer[i+1]))
+			}
+		}
+		tree.layers = append(tree.layers, next)
+	}
+	return tree
+}
+
+//Root merkle root of the tree, zero hash for an empty tree
+func (tree *MerkleTree) Root() common.Hash {
+	top := tree.layers[len(tree.layers)-1]
+	if len(top) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(top[0])
+}
+
+//Proof merkle proof of leaf, sibling hashes from bottom to top
+func (tree *MerkleTree) Proof(leaf []byte) ([]common.Hash, error) {
+	layer := tree.layers[0]
+	idx := sort.Search(len(layer), func(i int) bool { return bytes.Compare(layer[i], leaf) >= 0 })
+	if idx == len(layer) || !bytes.Equal(layer[idx], leaf) {
+		return nil, errors.New("leaf is not in merkle tree")
+	}
+	proof := make([]common.Hash, 0, len(tree.layers)-1)
+	for _, layer := range tree.layers[:len(tree.layers)-1] {
+		pairIdx := idx ^ 1
+		if pairIdx < len(layer) {
+			proof = append(proof, common.BytesToHash(layer[pairIdx]))
+		}
+		idx /= 2
+	}
+	return proof, nil
+}
+
+//VerifyMerkleProof check that leaf belongs to the merkle tree with given root
+func VerifyMerkleProof(root common.Hash, leaf []byte, proof []common.Hash) bool {
+	computed := leaf
+	for _, p := range proof {
+		computed = combinedHash(computed, p.Bytes())
+	}
+	return bytes.Equal(computed, root.Bytes())
+}
+
+//VerifyClaim check a claim the same way MerkleDistributor.claim does
+func VerifyClaim(root common.Hash, index uint64, ethaddr common.Address, amount *big.Int, proof []common.Hash) bool {
+	return VerifyMerkleProof(root, MerkleLeaf(index, ethaddr, amount), proof)
+}
+
+func combinedHash(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return ecrypto.Keccak256(a, b)
+}
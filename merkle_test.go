@@ -0,0 +1,85 @@
+package ytttransfer
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//merkle vectors computed independently the way MerkleDistributor and its BalanceTree do:
+//leaf is keccak256(abi.encodePacked(index, account, amount)), pairs are hashed in sorted order and an odd node is promoted
+var merkleVectors = []struct {
+	index   uint64
+	ethaddr string
+	amount  *big.Int
+	leaf    string
+}{
+	{0, "0x00000000000000000000000000000000000000a1", new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18)), "d6eebd9e24e1ace6af6e8dddc8453b7103923b5823372769240c81fad83bf060"},
+	{1, "0x00000000000000000000000000000000000000b2", new(big.Int).Mul(big.NewInt(250), big.NewInt(1e18)), "871f413137cd49a1f92a21b31948358a6ecb1de443bc35140ec616780d94a6b4"},
+	{2, "0x00000000000000000000000000000000000000c3", big.NewInt(1), "56a58c5978fe60a0097d369f5ae78260a12f4b062e463448853e143ea40efcb7"},
+}
+
+func merkleLeaves(n int) [][]byte {
+	leaves := make([][]byte, 0, n)
+	for _, v := range merkleVectors[:n] {
+		leaves = append(leaves, MerkleLeaf(v.index, common.HexToAddress(v.ethaddr), v.amount))
+	}
+	return leaves
+}
+
+func TestMerkleLeaf(t *testing.T) {
+	for i, leaf := range merkleLeaves(len(merkleVectors)) {
+		if got := hex.EncodeToString(leaf); got != merkleVectors[i].leaf {
+			t.Errorf("leaf %d is %s, want %s", i, got, merkleVectors[i].leaf)
+		}
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	cases := []struct {
+		n    int
+		root string
+	}{
+		{2, "0x2670eaa83c28335751031aad27752b5407c3e57216b0d3d5892f6a3d443db12f"},
+		{3, "0x33522f2f721c80693ca677098ef4bfbcd67b86d4cc25a5c652a61a75e542140c"},
+	}
+	for _, c := range cases {
+		leaves := merkleLeaves(c.n)
+		tree := NewMerkleTree(leaves)
+		if got := tree.Root().Hex(); got != c.root {
+			t.Fatalf("root of %d leaves is %s, want %s", c.n, got, c.root)
+		}
+		// order and duplicates of leaves do not matter
+		reversed := make([][]byte, 0, 2*c.n)
+		for i := c.n - 1; i >= 0; i-- {
+			reversed = append(reversed, leaves[i], leaves[i])
+		}
+		if got := NewMerkleTree(reversed).Root().Hex(); got != c.root {
+			t.Fatalf("root of reversed %d leaves is %s, want %s", c.n, got, c.root)
+		}
+		for i, v := range merkleVectors[:c.n] {
+			proof, err := tree.Proof(leaves[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyClaim(tree.Root(), v.index, common.HexToAddress(v.ethaddr), v.amount, proof) {
+				t.Fatalf("claim %d of %d leaves is rejected", i, c.n)
+			}
+			if VerifyClaim(tree.Root(), v.index, common.HexToAddress(v.ethaddr), new(big.Int).Add(v.amount, big.NewInt(1)), proof) {
+				t.Fatalf("claim %d of %d leaves with another amount is accepted", i, c.n)
+			}
+		}
+	}
+}
+
+func TestMerkleEmpty(t *testing.T) {
+	tree := NewMerkleTree(nil)
+	if tree.Root() != (common.Hash{}) {
+		t.Fatalf("root of empty tree is %s", tree.Root().Hex())
+	}
+	if _, err := tree.Proof(merkleLeaves(1)[0]); err == nil {
+		t.Fatal("proof of missing leaf")
+	}
+}
@@ -0,0 +1,151 @@
+package ytttransfer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//MaxRegMessageLifetime longest allowed period between issued-at and expiry of a registration message
+const MaxRegMessageLifetime = 24 * time.Hour
+
+//ErrInvalidNonce nonce does not exist, belongs to another account, is expired or already used
+var ErrInvalidNonce = errors.New("nonce is invalid, expired or already used")
+
+//RegMessage structured registration payload signed by EOS account
+type RegMessage struct {
+	Domain   string `json:"domain"`
+	ChainID  string `json:"chainId"`
+	Account  string `json:"account"`
+	EthAddr  string `json:"ethaddr"`
+	Nonce    string `json:"nonce"`
+	IssuedAt int64  `json:"issuedAt"`
+	Expiry   int64  `json:"expiry"`
+}
+
+//Nonce server issued one-time value of registration message, only stored once it is used
+type Nonce struct {
+	Nonce    string    `bson:"_id" json:"nonce"`
+	Account  string    `bson:"account" json:"account"`
+	IssuedAt int64     `bson:"issuedAt" json:"issuedAt"`
+	Expiry   int64     `bson:"expiry" json:"expiry"`
+	ExpireAt time.Time `bson:"expireAt" json:"-"` // used nonce is removed by TTL index after expiry
+}
+
+//NonceIssuer issue nonces authenticated by HMAC, nothing is stored until a nonce is used
+type NonceIssuer struct {
+	key []byte
+}
+
+//Bytes canonical text of registration message which is hashed and signed
+func (msg *RegMessage) Bytes() []byte {
+	return []byte(fmt.Sprintf("domain=%s&chainId=%s&account=%s&ethaddr=%s&nonce=%s&issuedAt=%d&expiry=%d", msg.Domain, msg.ChainID, msg.Account, msg.EthAddr, msg.Nonce, msg.IssuedAt, msg.Expiry))
+}
+
+//Check check domain separation fields and validity period of registration message
+func (msg *RegMessage) Check(domain, chainID string, now time.Time) error {
+	if msg.Domain != domain {
+		return fmt.Errorf("domain mismatch: %s", msg.Domain)
+	}
+	if msg.ChainID != chainID {
+		return fmt.Errorf("chain id mismatch: %s", msg.ChainID)
+	}
+	if msg.Nonce == "" {
+		return errors.New("nonce is empty")
+	}
+	return checkPeriod(msg.IssuedAt, msg.Expiry, now)
+}
+
+func checkPeriod(issuedAt, expiry int64, now time.Time) error {
+	if issuedAt > now.Add(time.Minute).Unix() {
+		return errors.New("message is issued in the future")
+	}
+	if expiry <= now.Unix() {
+		return errors.New("message is expired")
+	}
+	if expiry-issuedAt > int64(MaxRegMessageLifetime/time.Second) {
+		return errors.New("message lifetime is too long")
+	}
+	return nil
+}
+
+//NewNonceIssuer create a nonce issuer with HMAC key, a random key is generated if key is empty
+//which invalidates outstanding nonces when the server restarts
+func NewNonceIssuer(key []byte) *NonceIssuer {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err.Error())
+		}
+	}
+	return &NonceIssuer{key: append([]byte{}, key...)}
+}
+
+//Issue issue a new nonce for account which expires after ttl, the nonce is random bytes followed by
+//HMAC of account, random bytes, issued-at and expiry
+func (issuer *NonceIssuer) Issue(account string, now time.Time, ttl time.Duration) (*Nonce, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	nonce := &Nonce{Account: account, IssuedAt: now.Unix(), Expiry: now.Add(ttl).Unix()}
+	random := hex.EncodeToString(buf)
+	nonce.Nonce = random + hex.EncodeToString(issuer.mac(account, random, nonce.IssuedAt, nonce.Expiry))
+	return nonce, nil
+}
+
+//Check check that nonce of msg is issued for msg.Account with the same issued-at and expiry and is not expired,
+//returns ErrInvalidNonce otherwise
+func (issuer *NonceIssuer) Check(msg *RegMessage, now time.Time) error {
+	if len(msg.Nonce) != 64 || msg.Expiry <= now.Unix() {
+		return ErrInvalidNonce
+	}
+	mac, err := hex.DecodeString(msg.Nonce[32:])
+	if err != nil || !hmac.Equal(mac, issuer.mac(msg.Account, msg.Nonce[:32], msg.IssuedAt, msg.Expiry)) {
+		return ErrInvalidNonce
+	}
+	return nil
+}
+
+func (issuer *NonceIssuer) mac(account, random string, issuedAt, expiry int64) []byte {
+	h := hmac.New(sha256.New, issuer.key)
+	h.Write([]byte(fmt.Sprintf("account=%s&random=%s&issuedAt=%d&expiry=%d", account, random, issuedAt, expiry)))
+	return h.Sum(nil)[:16]
+}
+
+//nonceCollection collection of used nonces, a TTL index removes them once they expire
+func (client *Mongoc) nonceCollection() *mongo.Collection {
+	collection := client.Client.Database("ytttransfer").Collection("nonce")
+	client.nonceIndex.Do(func() {
+		_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{Keys: bson.M{"expireAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)})
+		if err != nil {
+			log.Printf("!!! error when create TTL index of nonce: %s\n", err.Error())
+		}
+	})
+	return collection
+}
+
+//UseNonce record nonce of account as used until expiry, returns ErrInvalidNonce if it has been used before
+func (client *Mongoc) UseNonce(nonce, account string, expiry int64) error {
+	_, err := client.nonceCollection().InsertOne(context.Background(), &Nonce{Nonce: nonce, Account: account, IssuedAt: time.Now().Unix(), Expiry: expiry, ExpireAt: time.Unix(expiry, 0)})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrInvalidNonce
+		}
+		log.Printf("!!! error when using nonce: %s -> %s\n", account, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package ytttransfer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+//recoverP256 recover secp256r1 public key from hash and signature in the form of recid(1) + r(32) + s(32)
+func recoverP256(hash []byte, sig []byte) (*ecdsa.PublicKey, error) {
+	if len(sig) != 65 {
+		return nil, errors.New("invalid signature length")
+	}
+	curve := elliptic.P256()
+	params := curve.Params()
+	recid := sig[0]
+	if recid > 3 {
+		return nil, errors.New("invalid recovery id")
+	}
+	r := new(big.Int).SetBytes(sig[1:33])
+	s := new(big.Int).SetBytes(sig[33:65])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(params.N) >= 0 || s.Cmp(params.N) >= 0 {
+		return nil, errors.New("invalid signature value")
+	}
+	// R.x = r + (recid / 2) * n
+	x := new(big.Int).Set(r)
+	if recid&2 != 0 {
+		x.Add(x, params.N)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, errors.New("invalid signature point")
+	}
+	y, err := decompressP256Y(x, recid&1 == 1)
+	if err != nil {
+		return nil, err
+	}
+	// Q = r^-1 * (s*R - e*G)
+	e := new(big.Int).SetBytes(hash)
+	if len(hash) > 32 {
+		e.SetBytes(hash[:32])
+	}
+	rInv := new(big.Int).ModInverse(r, params.N)
+	sRx, sRy := curve.ScalarMult(x, y, s.Bytes())
+	negE := new(big.Int).Neg(e)
+	negE.Mod(negE, params.N)
+	eGx, eGy := curve.ScalarBaseMult(negE.Bytes())
+	sumx, sumy := curve.Add(sRx, sRy, eGx, eGy)
+	qx, qy := curve.ScalarMult(sumx, sumy, rInv.Bytes())
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("recovered point at infinity")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}, nil
+}
+
+//decompressP256Y compute y of a point on secp256r1 from x and parity of y
+func decompressP256Y(x *big.Int, odd bool) (*big.Int, error) {
+	params := elliptic.P256().Params()
+	// y^2 = x^3 - 3x + b
+	x3 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	threeX := new(big.Int).Mul(x, big.NewInt(3))
+	y2 := new(big.Int).Sub(x3, threeX)
+	y2.Add(y2, params.B)
+	y2.Mod(y2, params.P)
+	y := new(big.Int).ModSqrt(y2, params.P)
+	if y == nil {
+		return nil, errors.New("point is not on curve")
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(params.P, y)
+	}
+	return y, nil
+}
+
+//compressP256 compressed form of secp256r1 public key
+func compressP256(pub *ecdsa.PublicKey) []byte {
+	out := make([]byte, 33)
+	out[0] = 0x02 + byte(pub.Y.Bit(0))
+	xb := pub.X.Bytes()
+	copy(out[33-len(xb):], xb)
+	return out
+}
@@ -0,0 +1,99 @@
+package ytttransfer
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	//PayoutQueued account is queued for payout, its ERC20 address is frozen
+	PayoutQueued = "queued"
+	//PayoutPaid tokens have been sent to ERC20 address of account
+	PayoutPaid = "paid"
+)
+
+var (
+	//ErrRegNotOpen registration window is not open yet
+	ErrRegNotOpen = errors.New("registration is not open yet")
+	//ErrRegClosed registration window is closed
+	ErrRegClosed = errors.New("registration is closed")
+	//ErrChangeLimit account has changed its ERC20 address too many times
+	ErrChangeLimit = errors.New("ERC20 address cannot be changed any more")
+	//ErrChangeClosed ERC20 address cannot be changed after change deadline
+	ErrChangeClosed = errors.New("ERC20 address cannot be changed after deadline")
+	//ErrPayoutFrozen ERC20 address cannot be changed once account is queued for payout
+	ErrPayoutFrozen = errors.New("ERC20 address is frozen for payout")
+	//ErrRegistryChanged registry entry is modified concurrently
+	ErrRegistryChanged = errors.New("registry entry is modified concurrently")
+	//ErrPayoutPaid payout state of an account cannot be changed once it has been paid
+	ErrPayoutPaid = errors.New("account has been paid")
+)
+
+//EthAddrChange previous ERC20 address of an account kept in its history
+type EthAddrChange struct {
+	EthAddr      string `json:"ethaddr"`
+	RegisteredAt int64  `json:"registeredat"`
+	ReplacedAt   int64  `json:"replacedat"`
+}
+
+//RegPolicy registration window and change policy of ERC20 addresses
+type RegPolicy struct {
+	Open           time.Time // registration opens, no limit if zero
+	Close          time.Time // registration closes, no limit if zero
+	MaxChanges     int       // how many times a registered address can be changed, unlimited if negative
+	ChangeDeadline time.Time // registered address cannot be changed after it, no limit if zero
+}
+
+//ParseRegPolicy parse times in RFC 3339 format, an empty time means no limit
+func ParseRegPolicy(open, close, changeDeadline string, maxChanges int) (*RegPolicy, error) {
+	policy := &RegPolicy{MaxChanges: maxChanges}
+	var err error
+	if policy.Open, err = parseOptionalTime(open); err != nil {
+		return nil, err
+	}
+	if policy.Close, err = parseOptionalTime(close); err != nil {
+		return nil, err
+	}
+	if policy.ChangeDeadline, err = parseOptionalTime(changeDeadline); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+//CheckWindow check whether registration window is open
+func (policy *RegPolicy) CheckWindow(now time.Time) error {
+	if !policy.Open.IsZero() && now.Before(policy.Open) {
+		return ErrRegNotOpen
+	}
+	if !policy.Close.IsZero() && !now.Before(policy.Close) {
+		return ErrRegClosed
+	}
+	return nil
+}
+
+//Check check whether reg can register ethaddr now, registering the same address again is not a change
+func (policy *RegPolicy) Check(reg *Registry, ethaddr string, now time.Time) error {
+	if err := policy.CheckWindow(now); err != nil {
+		return err
+	}
+	if reg.PayoutStatus != "" {
+		return ErrPayoutFrozen
+	}
+	if reg.EthAddr == "" || reg.EthAddr == ethaddr {
+		return nil
+	}
+	if policy.MaxChanges >= 0 && reg.Changes >= policy.MaxChanges {
+		return ErrChangeLimit
+	}
+	if !policy.ChangeDeadline.IsZero() && !now.Before(policy.ChangeDeadline) {
+		return ErrChangeClosed
+	}
+	return nil
+}
+
+func parseOptionalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//AdminSigWindow how far the timestamp of a signed admin request may be from server time
+const AdminSigWindow = 5 * time.Minute
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+//AdminExcludeRequest body of POST /admin/exclude
+type AdminExcludeRequest struct {
+	Account string `json:"account"`
+	Exclude bool   `json:"exclude"`
+	Reason  string `json:"reason"`
+}
+
+//AdminEthAddrRequest body of POST /admin/ethaddr
+type AdminEthAddrRequest struct {
+	Account       string `json:"account"`
+	EthAddr       string `json:"ethaddr"`
+	Justification string `json:"justification"`
+}
+
+//AdminPayoutRequest body of POST /admin/payout
+type AdminPayoutRequest struct {
+	Account string `json:"account"`
+	Status  string `json:"status"` // queued or paid, empty to unqueue
+	TxHash  string `json:"txHash"`
+	Block   uint64 `json:"block"`
+}
+
+//AdminRefetchRequest body of POST /admin/refetch
+type AdminRefetchRequest struct {
+	Account string `json:"account"`
+}
+
+type adminHandler func(w http.ResponseWriter, r *http.Request, origin *yt.Origin)
+
+//errAuthUnavailable signature of admin request cannot be recorded as used
+var errAuthUnavailable = errors.New("signature cannot be recorded")
+
+//admin authenticate operator by X-API-Key header, or by X-Admin-Timestamp and X-Admin-Signature headers
+//signed by one of admin keys over ytttransfer.AdminMessage, a signature is accepted only once
+func (s *Server) admin(method string, handler adminHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, r, ErrMethodNotAllowed, "")
+			return
+		}
+		origin, err := s.authenticate(r)
+		if err == errAuthUnavailable {
+			writeError(w, r, ErrInternal, "")
+			return
+		}
+		if bodyTooLarge(err) {
+			writeError(w, r, ErrBodyTooLarge, "")
+			return
+		}
+		if err != nil {
+			writeError(w, r, ErrUnauthorized, err.Error())
+			fmt.Printf("!!! admin -> authentication error: %s %s from %s: %s\n", r.Method, r.URL.Path, s.clientIP(r), err.Error())
+			return
+		}
+		handler(w, r, origin)
+	}
+}
+
+func (s *Server) authenticate(r *http.Request) (*yt.Origin, error) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		if s.config.AdminAPIKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(s.config.AdminAPIKey)) != 1 {
+			return nil, fmt.Errorf("invalid API key")
+		}
+		return &yt.Origin{Signature: "api-key", ClientIP: s.clientIP(r)}, nil
+	}
+	sig := r.Header.Get("X-Admin-Signature")
+	if sig == "" {
+		return nil, fmt.Errorf("API key or signature is required")
+	}
+	timestamp := r.Header.Get("X-Admin-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+	if d := s.config.Now().Sub(time.Unix(ts, 0)); d > AdminSigWindow || d < -AdminSigWindow {
+		return nil, fmt.Errorf("timestamp is out of window")
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	msg := yt.AdminMessage(r.Method, r.URL.RequestURI(), timestamp, body)
+	for _, pubkey := range s.config.AdminKeys {
+		if s.verifier.Verify(pubkey, msg, sig) {
+			digest := sha256.Sum256([]byte(sig))
+			err = s.store.UseNonce("admin:"+hex.EncodeToString(digest[:]), "admin", ts+int64(AdminSigWindow/time.Second))
+			if err == yt.ErrInvalidNonce {
+				return nil, fmt.Errorf("signature is already used")
+			}
+			if err != nil {
+				fmt.Printf("!!! admin -> UseNonce error: %s\n", err.Error())
+				return nil, errAuthUnavailable
+			}
+			return &yt.Origin{Signature: sig, ClientIP: s.clientIP(r)}, nil
+		}
+	}
+	s.metrics.sigFailure(SigAdmin)
+	return nil, fmt.Errorf("invalid signature")
+}
+
+//handleAdminExclude POST /admin/exclude excludes account from or includes it in distribution
+func (s *Server) handleAdminExclude(w http.ResponseWriter, r *http.Request, origin *yt.Origin) {
+	formData := new(AdminExcludeRequest)
+	err := json.NewDecoder(r.Body).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(formData.Account) == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	if strings.TrimSpace(formData.Reason) == "" {
+		writeError(w, r, ErrReasonRequired, "")
+		return
+	}
+	err = s.store.SetExclude(formData.Account, formData.Exclude, formData.Reason, origin)
+	if err != nil {
+		writeAccountError(w, r, err)
+		fmt.Printf("!!! admin -> SetExclude error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, 0, MsgOK)
+	fmt.Printf("admin set exclude: %s -> %t (%s) from %s\n", formData.Account, formData.Exclude, formData.Reason, origin.ClientIP)
+}
+
+//handleAdminEthAddr POST /admin/ethaddr overrides ERC20 address of account
+func (s *Server) handleAdminEthAddr(w http.ResponseWriter, r *http.Request, origin *yt.Origin) {
+	formData := new(AdminEthAddrRequest)
+	err := json.NewDecoder(r.Body).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(formData.Account) == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	if strings.TrimSpace(formData.EthAddr) == "" {
+		writeError(w, r, ErrEthAddrRequired, "")
+		return
+	}
+	ethAddress, err := yt.ValidateEthAddr(formData.EthAddr)
+	if err != nil {
+		writeError(w, r, ErrInvalidEthAddr, err.Error())
+		return
+	}
+	if strings.TrimSpace(formData.Justification) == "" {
+		writeError(w, r, ErrReasonRequired, "")
+		return
+	}
+	err = s.store.OverrideEthAddr(formData.Account, ethAddress.Hex(), formData.Justification, origin)
+	if err != nil {
+		switch err {
+		case yt.ErrPayoutFrozen:
+			writeError(w, r, ErrPayoutFrozen, "")
+		case yt.ErrRegistryChanged:
+			writeError(w, r, ErrRegistryChanged, "")
+		default:
+			writeAccountError(w, r, err)
+		}
+		fmt.Printf("!!! admin -> OverrideEthAddr error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, ethAddress.Hex(), MsgOK)
+	fmt.Printf("admin override eth address: %s -> %s (%s) from %s\n", formData.Account, ethAddress.Hex(), formData.Justification, origin.ClientIP)
+}
+
+//handleAdminRefetch POST /admin/refetch re-fetches public key and balance of account from chain
+func (s *Server) handleAdminRefetch(w http.ResponseWriter, r *http.Request, origin *yt.Origin) {
+	formData := new(AdminRefetchRequest)
+	err := json.NewDecoder(r.Body).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	account := strings.TrimSpace(formData.Account)
+	if account == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	pubkey, err := s.chain.GetPubKey(account)
+	if err != nil {
+		writeError(w, r, ErrChainUnavailable, "")
+		fmt.Printf("!!! admin -> get chain public key error: %s\n", err.Error())
+		return
+	}
+	pubkey, err = key.Canonical(pubkey)
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! admin -> parse chain public key error: %s\n", err.Error())
+		return
+	}
+	balance, err := s.chain.GetBalance(account)
+	if err != nil {
+		writeError(w, r, ErrChainUnavailable, "")
+		fmt.Printf("!!! admin -> get balance error: %s\n", err.Error())
+		return
+	}
+	err = s.store.UpdateKeyBalance(account, pubkey, balance, origin)
+	if err != nil {
+		switch err {
+		case yt.ErrPayoutFrozen:
+			writeError(w, r, ErrPayoutFrozen, "")
+		case yt.ErrRegistryChanged:
+			writeError(w, r, ErrRegistryChanged, "")
+		default:
+			writeAccountError(w, r, err)
+		}
+		fmt.Printf("!!! admin -> UpdateKeyBalance error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, map[string]interface{}{"pubkey": pubkey, "balance": balance}, MsgOK)
+	fmt.Printf("admin refetch: %s -> %s %d from %s\n", account, pubkey, balance, origin.ClientIP)
+}
+
+//handleAdminAccounts GET /admin/accounts?status=&skip=&limit= lists accounts in status
+func (s *Server) handleAdminAccounts(w http.ResponseWriter, r *http.Request, origin *yt.Origin) {
+	vals := r.URL.Query()
+	skip, limit := int64(0), int64(defaultListLimit)
+	var err error
+	if v := vals.Get("skip"); v != "" {
+		if skip, err = strconv.ParseInt(v, 10, 64); err != nil || skip < 0 {
+			writeError(w, r, ErrBadRequest, "skip")
+			return
+		}
+	}
+	if v := vals.Get("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil || limit <= 0 || limit > maxListLimit {
+			writeError(w, r, ErrBadRequest, "limit")
+			return
+		}
+	}
+	regs, err := s.store.ListAccounts(vals.Get("status"), skip, limit)
+	if err != nil {
+		if err == yt.ErrUnknownStatus {
+			writeError(w, r, ErrBadRequest, err.Error())
+		} else {
+			writeError(w, r, ErrInternal, "")
+			fmt.Printf("!!! admin -> ListAccounts error: %s\n", err.Error())
+		}
+		return
+	}
+	writeOK(w, r, regs, MsgOK)
+}
+
+//handleAdminPayout POST /admin/payout records payout state of account with its transfer transaction
+func (s *Server) handleAdminPayout(w http.ResponseWriter, r *http.Request, origin *yt.Origin) {
+	formData := new(AdminPayoutRequest)
+	err := json.NewDecoder(r.Body).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	account := strings.TrimSpace(formData.Account)
+	if account == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	switch formData.Status {
+	case "", yt.PayoutQueued:
+	case yt.PayoutPaid:
+		if len(common.FromHex(formData.TxHash)) != common.HashLength || formData.Block == 0 {
+			writeError(w, r, ErrBadRequest, "transaction hash and block are required")
+			return
+		}
+	default:
+		writeError(w, r, ErrBadRequest, "status")
+		return
+	}
+	err = s.store.SetPayout(account, formData.Status, formData.TxHash, formData.Block, origin)
+	if err != nil {
+		if err == yt.ErrPayoutPaid {
+			writeError(w, r, ErrAlreadyPaid, "")
+		} else {
+			writeAccountError(w, r, err)
+		}
+		fmt.Printf("!!! admin -> SetPayout error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, 0, MsgOK)
+	fmt.Printf("admin set payout: %s -> %q %s %d from %s\n", account, formData.Status, formData.TxHash, formData.Block, origin.ClientIP)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+)
+
+func TestAdminAuth(t *testing.T) {
+	body := &AdminExcludeRequest{Account: "alice", Exclude: true, Reason: "test"}
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/admin/exclude", signed: true, status: 405, code: ErrMethodNotAllowed},
+		{name: "missing credentials", method: "POST", target: "/admin/exclude", body: body, status: 401, code: ErrUnauthorized},
+		{name: "bad API key", method: "POST", target: "/admin/exclude", body: body, header: map[string]string{"X-API-Key": "wrong"}, status: 401, code: ErrUnauthorized},
+		{name: "API key disabled", method: "POST", target: "/admin/exclude", body: body, header: map[string]string{"X-API-Key": testAPIKey}, config: func(c *Config) { c.AdminAPIKey = "" }, status: 401, code: ErrUnauthorized},
+		{name: "bad timestamp", method: "POST", target: "/admin/exclude", body: body, signed: true, header: map[string]string{"X-Admin-Timestamp": "now"}, status: 401, code: ErrUnauthorized},
+		{name: "timestamp out of window", method: "POST", target: "/admin/exclude", body: body, signed: true, header: map[string]string{"X-Admin-Timestamp": strconv.FormatInt(testNow.Add(-AdminSigWindow-time.Second).Unix(), 10)}, status: 401, code: ErrUnauthorized},
+		{name: "bad signature", method: "POST", target: "/admin/exclude", body: body, signed: true, header: map[string]string{"X-Admin-Signature": "sig"}, status: 401, code: ErrUnauthorized},
+		{name: "internal error of signature", method: "POST", target: "/admin/exclude", body: body, signed: true, setup: failStore("UseNonce", errDown), status: 500, code: ErrInternal},
+		{name: "success by API key", method: "POST", target: "/admin/exclude", body: body, header: map[string]string{"X-API-Key": testAPIKey}, status: 200},
+		{name: "success by signature", method: "POST", target: "/admin/exclude", body: body, signed: true, status: 200},
+	})
+}
+
+func TestAdminSignatureReplay(t *testing.T) {
+	f := newFixture(t, nil)
+	c := &apiCase{method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Account: "alice", Exclude: true, Reason: "test"}, signed: true}
+	if w, resp := f.do(t, c); w.Code != 200 {
+		t.Fatalf("first request: %d %s", w.Code, resp.Error)
+	}
+	if w, resp := f.do(t, c); w.Code != 401 || resp.Error != ErrUnauthorized {
+		t.Fatalf("replayed request: %d %s", w.Code, resp.Error)
+	}
+}
+
+func TestAdminDisabled(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "not found", method: "POST", target: "/admin/exclude", header: map[string]string{"X-API-Key": testAPIKey}, config: func(c *Config) { c.AdminAPIKey, c.AdminKeys = "", nil }, status: 404},
+	})
+}
+
+func TestHandleAdminExclude(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "bad json", method: "POST", target: "/admin/exclude", body: "{", signed: true, status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Reason: "test"}, signed: true, status: 400, code: ErrAccountRequired},
+		{name: "missing reason", method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Account: "alice"}, signed: true, status: 400, code: ErrReasonRequired},
+		{name: "not found", method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Account: "nobody", Reason: "test"}, signed: true, status: 404, code: ErrAccountNotFound},
+		{name: "internal error", method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Account: "alice", Reason: "test"}, signed: true, setup: failStore("SetExclude", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/admin/exclude", body: &AdminExcludeRequest{Account: "alice", Exclude: true, Reason: "test"}, signed: true, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if reg := f.store.regs["alice"]; !reg.Exclude || reg.ExcludeReason != "test" {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+	})
+}
+
+func TestHandleAdminEthAddr(t *testing.T) {
+	req := func(account, ethaddr, justification string) *AdminEthAddrRequest {
+		return &AdminEthAddrRequest{Account: account, EthAddr: ethaddr, Justification: justification}
+	}
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/admin/ethaddr", signed: true, status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/admin/ethaddr", body: "{", signed: true, status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/admin/ethaddr", body: req("", testAddrA, "test"), signed: true, status: 400, code: ErrAccountRequired},
+		{name: "missing ethaddr", method: "POST", target: "/admin/ethaddr", body: req("alice", "", "test"), signed: true, status: 400, code: ErrEthAddrRequired},
+		{name: "invalid ethaddr", method: "POST", target: "/admin/ethaddr", body: req("alice", "0x1234", "test"), signed: true, status: 400, code: ErrInvalidEthAddr},
+		{name: "missing justification", method: "POST", target: "/admin/ethaddr", body: req("alice", testAddrA, ""), signed: true, status: 400, code: ErrReasonRequired},
+		{name: "not found", method: "POST", target: "/admin/ethaddr", body: req("nobody", testAddrA, "test"), signed: true, status: 404, code: ErrAccountNotFound},
+		{name: "frozen", method: "POST", target: "/admin/ethaddr", body: req("dave", testAddrA, "test"), signed: true, status: 409, code: ErrPayoutFrozen},
+		{name: "paid", method: "POST", target: "/admin/ethaddr", body: req("erin", testAddrA, "test"), signed: true, status: 409, code: ErrPayoutFrozen},
+		{name: "registry changed", method: "POST", target: "/admin/ethaddr", body: req("alice", testAddrA, "test"), signed: true, setup: failStore("OverrideEthAddr", yt.ErrRegistryChanged), status: 409, code: ErrRegistryChanged},
+		{name: "internal error", method: "POST", target: "/admin/ethaddr", body: req("alice", testAddrA, "test"), signed: true, setup: failStore("OverrideEthAddr", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/admin/ethaddr", body: req("alice", strings.ToLower(testAddrA), "test"), signed: true, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if resp.Data != testAddrA || f.store.regs["alice"].EthAddr != testAddrA {
+					t.Fatalf("ethaddr is %v", resp.Data)
+				}
+			}},
+	})
+}
+
+func TestHandleAdminRefetch(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/admin/refetch", signed: true, status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/admin/refetch", body: "{", signed: true, status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{}, signed: true, status: 400, code: ErrAccountRequired},
+		{name: "chain unavailable", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "alice"}, signed: true, setup: failChain("GetPubKey"), status: 502, code: ErrChainUnavailable},
+		{name: "bad chain key", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "broken"}, signed: true, status: 500, code: ErrInternal},
+		{name: "balance unavailable", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "alice"}, signed: true, setup: failChain("GetBalance"), status: 502, code: ErrChainUnavailable},
+		{name: "not found", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "frank"}, signed: true, status: 404, code: ErrAccountNotFound},
+		{name: "frozen", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "dave"}, signed: true, status: 409, code: ErrPayoutFrozen,
+			setup: func(f *fixture) { f.chain.accounts["dave"] = &chainAccount{pubkey: testYTAKey, balance: 1} },
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if reg := f.store.regs["dave"]; reg.Balance != 300 {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+		{name: "registry changed", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "alice"}, signed: true, setup: failStore("UpdateKeyBalance", yt.ErrRegistryChanged), status: 409, code: ErrRegistryChanged},
+		{name: "internal error", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "alice"}, signed: true, setup: failStore("UpdateKeyBalance", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/admin/refetch", body: &AdminRefetchRequest{Account: "alice"}, signed: true, status: 200,
+			setup: func(f *fixture) { f.chain.accounts["alice"].balance = 150 },
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if reg := f.store.regs["alice"]; reg.Pubkey != testKey || reg.Balance != 150 {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+	})
+}
+
+func TestHandleAdminAccounts(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "bad method", method: "POST", target: "/admin/accounts", signed: true, status: 405, code: ErrMethodNotAllowed},
+		{name: "bad skip", method: "GET", target: "/admin/accounts?skip=-1", signed: true, status: 400, code: ErrBadRequest},
+		{name: "bad limit", method: "GET", target: "/admin/accounts?limit=0", signed: true, status: 400, code: ErrBadRequest},
+		{name: "limit too large", method: "GET", target: "/admin/accounts?limit=1001", signed: true, status: 400, code: ErrBadRequest},
+		{name: "unknown status", method: "GET", target: "/admin/accounts?status=bogus", signed: true, status: 400, code: ErrBadRequest},
+		{name: "internal error", method: "GET", target: "/admin/accounts", signed: true, setup: failStore("ListAccounts", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "GET", target: "/admin/accounts?status=queued&limit=10", signed: true, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.([]interface{})
+				if len(data) != 1 || data[0].(map[string]interface{})["_id"] != "dave" {
+					t.Fatalf("accounts are %v", data)
+				}
+			}},
+	})
+}
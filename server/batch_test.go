@@ -0,0 +1,29 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleBatch(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/batch", status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/batch", body: "{", status: 400, code: ErrBadRequest},
+		{name: "missing accounts", method: "POST", target: "/batch", body: &BatchRequest{}, status: 400, code: ErrAccountRequired},
+		{name: "too many accounts", method: "POST", target: "/batch", body: &BatchRequest{Accounts: []string{"a", "b", "c", "d"}}, status: 413, code: ErrBatchTooLarge},
+		{name: "internal error", method: "POST", target: "/batch", body: &BatchRequest{Accounts: []string{"alice"}}, setup: failStore("GetAccountInfos", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/batch", body: &BatchRequest{Accounts: []string{"bob", "nobody", "alice"}}, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.([]interface{})
+				found := make([]string, 0)
+				for _, d := range data {
+					result := d.(map[string]interface{})
+					found = append(found, result["account"].(string)+":"+strconv.FormatBool(result["found"].(bool)))
+				}
+				if strings.Join(found, ",") != "bob:true,nobody:false,alice:true" {
+					t.Fatalf("results are %v", found)
+				}
+			}},
+	})
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+//bigBody request body larger than MaxBodyBytes of fixture
+var bigBody = `{"account":"` + strings.Repeat("a", 2048) + `"}`
+
+func TestBodyLimit(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "reg", method: "POST", target: "/reg", body: bigBody, status: 413, code: ErrBodyTooLarge},
+		{name: "late", method: "POST", target: "/late", body: bigBody, status: 413, code: ErrBodyTooLarge},
+		{name: "batch", method: "POST", target: "/batch", body: bigBody, status: 413, code: ErrBodyTooLarge},
+		{name: "admin", method: "POST", target: "/admin/exclude", body: bigBody, signed: true, status: 413, code: ErrBodyTooLarge},
+		{name: "within limit", method: "POST", target: "/batch", body: `{"accounts":["` + strings.Repeat("a", 1000) + `"]}`, status: 200},
+		{name: "unlimited", method: "POST", target: "/reg", body: bigBody, config: func(c *Config) { c.MaxBodyBytes = 0 }, status: 400, code: ErrEthAddrRequired},
+	})
+}
@@ -0,0 +1,488 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+	"github.com/aurawing/ytttransfer/eostx"
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//BatchRequest body of POST /batch
+type BatchRequest struct {
+	Accounts []string `json:"accounts"`
+}
+
+//BatchResult status of an account in batch query
+type BatchResult struct {
+	Account string            `json:"account"`
+	Found   bool              `json:"found"`
+	Status  *yt.AccountStatus `json:"status,omitempty"`
+}
+
+//handleBalance GET /balance?account= returns snapshot balance of account
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	vals := r.URL.Query()
+	if vals == nil || len(vals) == 0 || vals["account"] == nil || len(vals["account"]) == 0 || strings.TrimSpace(vals["account"][0]) == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	account := vals["account"][0]
+	if !s.limitAccount(w, r, account) {
+		return
+	}
+	reg, err := s.store.GetAccountInfo(account)
+	if err != nil {
+		writeAccountError(w, r, err)
+		fmt.Printf("!!! balance -> get account info error: %s\n", err.Error())
+		return
+	}
+	if reg.Exclude {
+		writeError(w, r, ErrAccountNotFound, "")
+		return
+	}
+	writeOK(w, r, reg.Balance, MsgOK)
+	return
+}
+
+//handleEthAddr GET /ethaddr?account= returns registered ERC20 address of account
+func (s *Server) handleEthAddr(w http.ResponseWriter, r *http.Request) {
+	vals := r.URL.Query()
+	if vals == nil || len(vals) == 0 || vals["account"] == nil || len(vals["account"]) == 0 || strings.TrimSpace(vals["account"][0]) == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	account := vals["account"][0]
+	if !s.limitAccount(w, r, account) {
+		return
+	}
+	reg, err := s.store.GetAccountInfo(account)
+	if err != nil {
+		writeAccountError(w, r, err)
+		fmt.Printf("!!! ethaddr -> get account info error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, reg.EthAddr, MsgOK)
+	return
+}
+
+//handleNonce GET /nonce?account=&ethaddr= issues a registration message with a fresh nonce
+func (s *Server) handleNonce(w http.ResponseWriter, r *http.Request) {
+	account := strings.TrimSpace(r.URL.Query().Get("account"))
+	if account == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	reg, err := s.store.GetAccountInfo(account)
+	if err != nil {
+		writeAccountError(w, r, err)
+		fmt.Printf("!!! nonce -> get account info error: %s\n", err.Error())
+		return
+	}
+	if s.config.RegPolicy != nil {
+		if err := s.config.RegPolicy.Check(reg, reg.EthAddr, s.config.Now()); err != nil {
+			writePolicyError(w, r, err)
+			return
+		}
+	}
+	nonce, err := s.nonces.Issue(account, s.config.Now(), s.config.NonceTTL)
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! nonce -> issue nonce error: %s\n", err.Error())
+		return
+	}
+	resp := &NonceResp{RegMessage: &yt.RegMessage{Domain: s.config.Domain, ChainID: s.config.ChainID, Account: account, Nonce: nonce.Nonce, IssuedAt: nonce.IssuedAt, Expiry: nonce.Expiry}}
+	if ethaddr := strings.TrimSpace(r.URL.Query().Get("ethaddr")); ethaddr != "" {
+		resp.EthAddr = ethaddr
+		if s.config.EIP712Domain != nil {
+			resp.TypedData = s.config.EIP712Domain.TypedData(resp.RegMessage)
+		}
+		if esr, err := resp.RegMessage.SigningRequest(); err == nil {
+			resp.ESR = esr
+		}
+	}
+	writeOK(w, r, resp, MsgOK)
+	return
+}
+
+//handleReg POST /reg registers ERC20 address of account signed by its EOS key
+func (s *Server) handleReg(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, ErrMethodNotAllowed, "")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	formData := new(yt.RegRequest)
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(&formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	account := formData.Account
+	if strings.Trim(account, " ") == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	ethaddr := formData.EthAddr
+	if strings.Trim(ethaddr, " ") == "" {
+		writeError(w, r, ErrEthAddrRequired, "")
+		return
+	}
+	ethAddress, err := yt.ValidateEthAddr(ethaddr)
+	if err != nil {
+		writeError(w, r, ErrInvalidEthAddr, err.Error())
+		return
+	}
+	sig := formData.Sig
+	if strings.Trim(sig, " ") == "" {
+		writeError(w, r, ErrSignatureRequired, "")
+		return
+	}
+	reg, err := s.store.GetAccountInfo(account)
+	if err != nil {
+		writeAccountError(w, r, err)
+		fmt.Printf("!!! reg -> get account info error: %s\n", err.Error())
+		return
+	}
+	if strings.EqualFold(reg.EthAddr, ethAddress.Hex()) {
+		writeError(w, r, ErrAlreadyRegistered, "")
+		return
+	}
+	if s.config.RegPolicy != nil {
+		if err := s.config.RegPolicy.Check(reg, ethAddress.Hex(), s.config.Now()); err != nil {
+			writePolicyError(w, r, err)
+			fmt.Printf("!!! reg -> registration policy error: %s -> %s: %s\n", account, ethAddress.Hex(), err.Error())
+			return
+		}
+	}
+	switch formData.SigType {
+	case "", yt.SigTypeRaw, yt.SigTypeScatter, yt.SigTypeESR:
+	default:
+		writeError(w, r, ErrBadSigType, "")
+		return
+	}
+	msg := &yt.RegMessage{Domain: s.config.Domain, ChainID: s.config.ChainID, Account: account, EthAddr: ethaddr, Nonce: formData.Nonce, IssuedAt: formData.IssuedAt, Expiry: formData.Expiry}
+	err = msg.Check(s.config.Domain, s.config.ChainID, s.config.Now())
+	if err != nil {
+		writeError(w, r, ErrInvalidMessage, err.Error())
+		fmt.Printf("!!! reg -> check message error: %s\n", err.Error())
+		return
+	}
+	if err = s.nonces.Check(msg, s.config.Now()); err != nil {
+		writeError(w, r, ErrInvalidNonce, "")
+		return
+	}
+	ethVerified := false
+	if strings.TrimSpace(formData.EthSig) != "" {
+		var ok bool
+		switch formData.EthSigType {
+		case "", "personal":
+			ok = s.verifier.VerifyEth(ethaddr, msg.Bytes(), formData.EthSig)
+		case "eip712":
+			if s.config.EIP712Domain == nil {
+				writeError(w, r, ErrBadEthSigType, "")
+				return
+			}
+			ok = s.verifier.VerifyEthTypedData(s.config.EIP712Domain, msg, formData.EthSig)
+		default:
+			writeError(w, r, ErrBadEthSigType, "")
+			return
+		}
+		if !ok {
+			writeError(w, r, ErrBadEthSignature, "")
+			s.metrics.sigFailure(SigEth)
+			fmt.Printf("!!! reg -> RegEthAddr error: %s\n", "ERC20地址签名验证失败")
+			return
+		}
+		ethVerified = true
+	} else if s.config.RequireEthSig {
+		writeError(w, r, ErrEthSigRequired, "")
+		return
+	}
+	chainKey := ""
+	if s.config.KeyPolicy != yt.KeyPolicySnapshot {
+		chainKey, err = s.chain.GetPubKey(account)
+		if err != nil {
+			writeError(w, r, ErrChainUnavailable, "")
+			fmt.Printf("!!! reg -> get chain public key error: %s\n", err.Error())
+			return
+		}
+		chainKey, err = key.Canonical(chainKey)
+		if err != nil {
+			writeError(w, r, ErrInternal, "")
+			fmt.Printf("!!! reg -> parse chain public key error: %s\n", err.Error())
+			return
+		}
+	}
+	decision := yt.DecideKey(s.config.KeyPolicy, reg.Pubkey, chainKey, func(pubkey string) bool {
+		return s.verifier.VerifyRegistration(pubkey, msg, formData.SigType, sig)
+	})
+	if decision.Accepted {
+		if !s.limitSigned(w, r, account) {
+			return
+		}
+		ethContract := false
+		if s.config.EthCaller != nil {
+			ethContract, err = yt.IsContract(r.Context(), s.config.EthCaller, ethAddress)
+			if err != nil {
+				writeError(w, r, ErrInternal, "")
+				fmt.Printf("!!! reg -> check contract error: %s\n", err.Error())
+				return
+			}
+			if ethContract && !formData.AllowContract {
+				writeError(w, r, ErrContractEthAddr, "")
+				return
+			}
+		}
+		err = s.store.UseNonce(msg.Nonce, account, msg.Expiry)
+		if err != nil {
+			if err == yt.ErrInvalidNonce {
+				writeError(w, r, ErrInvalidNonce, "")
+			} else {
+				writeError(w, r, ErrInternal, "")
+			}
+			fmt.Printf("!!! reg -> UseNonce error: %s\n", err.Error())
+			return
+		}
+		err = s.store.RegEthAddr(account, reg, &yt.Registration{EthAddr: ethAddress.Hex(), EthVerified: ethVerified, EthContract: ethContract, KeyDecision: decision}, &yt.Origin{Signature: sig, ClientIP: s.clientIP(r)})
+		if err != nil {
+			if err == yt.ErrRegistryChanged {
+				writeError(w, r, ErrRegistryChanged, "")
+			} else {
+				writeError(w, r, ErrInternal, "")
+			}
+			fmt.Printf("!!! reg -> RegEthAddr error: %s\n", err.Error())
+			return
+		}
+		writeOK(w, r, 0, MsgRegistered)
+		s.metrics.registered(s.config.Now())
+		fmt.Printf("register eth address success: %s -> %s (eth verified: %t, contract: %t)\n", account, ethAddress.Hex(), ethVerified, ethContract)
+		return
+	} else {
+		writeError(w, r, ErrBadSignature, "")
+		s.metrics.sigFailure(SigEOS)
+		fmt.Printf("!!! reg -> RegEthAddr error: %s (key policy: %s, snapshot key ok: %t, chain key ok: %t)\n", "签名验证失败", decision.Policy, decision.SnapshotOK, decision.ChainOK)
+		return
+	}
+}
+
+//handleStatus GET /status?account= returns lifecycle status of account,
+//GET /status?ethaddr= returns status of all accounts bound to ERC20 address
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	vals := r.URL.Query()
+	if account := strings.TrimSpace(vals.Get("account")); account != "" {
+		if !s.limitAccount(w, r, account) {
+			return
+		}
+		reg, err := s.store.GetAccountInfo(account)
+		if err != nil {
+			writeAccountError(w, r, err)
+			fmt.Printf("!!! status -> get account info error: %s\n", err.Error())
+			return
+		}
+		writeOK(w, r, yt.NewAccountStatus(reg), MsgOK)
+		return
+	}
+	ethaddr := strings.TrimSpace(vals.Get("ethaddr"))
+	if ethaddr == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	ethAddress, err := yt.ValidateEthAddr(ethaddr)
+	if err != nil {
+		writeError(w, r, ErrInvalidEthAddr, err.Error())
+		return
+	}
+	regs, err := s.store.GetAccountsByEthAddr(ethAddress)
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! status -> get accounts of ethaddr error: %s\n", err.Error())
+		return
+	}
+	statuses := make([]*yt.AccountStatus, 0, len(regs))
+	for _, reg := range regs {
+		statuses = append(statuses, yt.NewAccountStatus(reg))
+	}
+	writeOK(w, r, statuses, MsgOK)
+}
+
+//handleBatch POST /batch returns status of up to BatchLimit accounts in request order, each account queried takes a token of its rate limit
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, ErrMethodNotAllowed, "")
+		return
+	}
+	formData := new(BatchRequest)
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(s.config.BatchLimit)*64+1024)).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if len(formData.Accounts) == 0 {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	if len(formData.Accounts) > s.config.BatchLimit {
+		writeError(w, r, ErrBatchTooLarge, strconv.Itoa(s.config.BatchLimit))
+		return
+	}
+	for _, account := range formData.Accounts {
+		if !s.limitAccount(w, r, account) {
+			return
+		}
+	}
+	regs, err := s.store.GetAccountInfos(formData.Accounts)
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! batch -> get account infos error: %s\n", err.Error())
+		return
+	}
+	found := make(map[string]*yt.Registry, len(regs))
+	for _, reg := range regs {
+		found[reg.Account] = reg
+	}
+	results := make([]*BatchResult, 0, len(formData.Accounts))
+	for _, account := range formData.Accounts {
+		result := &BatchResult{Account: account}
+		if reg, ok := found[account]; ok {
+			result.Found = true
+			result.Status = yt.NewAccountStatus(reg)
+		}
+		results = append(results, result)
+	}
+	writeOK(w, r, results, MsgOK)
+}
+
+//handleLate POST /late adds an EOS account missing from snapshot to registry, signed by its current active key
+func (s *Server) handleLate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, ErrMethodNotAllowed, "")
+		return
+	}
+	formData := new(yt.LateRequest)
+	err := json.NewDecoder(r.Body).Decode(formData)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	account := strings.TrimSpace(formData.Account)
+	if account == "" {
+		writeError(w, r, ErrAccountRequired, "")
+		return
+	}
+	if strings.TrimSpace(formData.Sig) == "" {
+		writeError(w, r, ErrSignatureRequired, "")
+		return
+	}
+	msg := &yt.LateRegMessage{Domain: s.config.Domain, ChainID: s.config.ChainID, Account: account, IssuedAt: formData.IssuedAt, Expiry: formData.Expiry}
+	err = msg.Check(s.config.Domain, s.config.ChainID, s.config.Now())
+	if err != nil {
+		writeError(w, r, ErrInvalidMessage, err.Error())
+		return
+	}
+	_, err = s.store.GetAccountInfo(account)
+	if err == nil {
+		writeError(w, r, ErrAlreadyInRegistry, "")
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! late -> get account info error: %s\n", err.Error())
+		return
+	}
+	pubkey, err := s.chain.GetPubKey(account)
+	if err != nil {
+		writeError(w, r, ErrChainUnavailable, "")
+		fmt.Printf("!!! late -> get chain public key error: %s\n", err.Error())
+		return
+	}
+	pubkey, err = key.Canonical(pubkey)
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! late -> parse chain public key error: %s\n", err.Error())
+		return
+	}
+	if !s.verifier.Verify(pubkey, msg.Bytes(), formData.Sig) {
+		writeError(w, r, ErrBadSignature, "")
+		s.metrics.sigFailure(SigEOS)
+		return
+	}
+	if !s.limitSigned(w, r, account) {
+		return
+	}
+	created, err := s.chain.GetCreated(account)
+	if err != nil {
+		writeError(w, r, ErrChainUnavailable, "")
+		fmt.Printf("!!! late -> get account creation time error: %s\n", err.Error())
+		return
+	}
+	switch err = s.config.LatePolicy.Check(account, created); err {
+	case nil:
+	case yt.ErrLateExcluded:
+		writeError(w, r, ErrAccountExcluded, "")
+		return
+	default:
+		writeError(w, r, ErrLateCutoff, "")
+		return
+	}
+	balance, err := s.chain.GetBalance(account)
+	if err != nil {
+		if err == eostx.ErrNoBalance {
+			writeError(w, r, ErrNoBalance, "")
+		} else {
+			writeError(w, r, ErrChainUnavailable, "")
+			fmt.Printf("!!! late -> get balance error: %s\n", err.Error())
+		}
+		return
+	}
+	err = s.store.AddLateRegistry(account, pubkey, balance, &yt.Origin{Signature: formData.Sig, ClientIP: s.clientIP(r)})
+	if err != nil {
+		if err == yt.ErrAlreadyInRegistry {
+			writeError(w, r, ErrAlreadyInRegistry, "")
+		} else {
+			writeError(w, r, ErrInternal, "")
+		}
+		fmt.Printf("!!! late -> AddLateRegistry error: %s\n", err.Error())
+		return
+	}
+	writeOK(w, r, balance, MsgLateRegistered)
+	fmt.Printf("late registration success: %s -> %d (created at %s)\n", account, balance, created.Format(time.RFC3339))
+}
+
+//handleProof GET /proof?ethaddr= returns merkle claims of ERC20 address
+func (s *Server) handleProof(w http.ResponseWriter, r *http.Request) {
+	ethaddr := strings.TrimSpace(r.URL.Query().Get("ethaddr"))
+	if ethaddr == "" {
+		writeError(w, r, ErrEthAddrRequired, "")
+		return
+	}
+	if !common.IsHexAddress(ethaddr) {
+		writeError(w, r, ErrInvalidEthAddr, yt.ErrEthAddrFormat.Error())
+		return
+	}
+	claims, err := s.config.Distribution.Claims(common.HexToAddress(ethaddr))
+	if err != nil {
+		writeError(w, r, ErrInternal, "")
+		fmt.Printf("!!! proof -> build merkle proof error: %s\n", err.Error())
+		return
+	}
+	if len(claims) == 0 {
+		writeError(w, r, ErrNotInDistribution, "")
+		return
+	}
+	writeOK(w, r, map[string]interface{}{"merkleRoot": s.config.Distribution.Tree.Root(), "claims": claims}, MsgOK)
+	return
+}
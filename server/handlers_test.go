@@ -0,0 +1,706 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+	"github.com/aurawing/ytttransfer/eostx"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	testDomain  = "ytttransfer"
+	testChainID = "aca376f206b8fc25a6ed44dbdc66547c36c6c33e3a119ffbeaef943642f0e906"
+	testKey     = "PUB_K1_79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHWykZkr"
+	testYTAKey  = "YTA79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHZUYw3o"
+	testR1Key   = "PUB_R1_6C2Ekbu5wWghkwwUinjodCqtrSL5qEdA9vb35MvYxzVwAyXYNR"
+	testAPIKey  = "api-key"
+	testToken   = "metrics-token"
+)
+
+var (
+	testNow   = time.Unix(1600000000, 0)
+	testAddrA = common.HexToAddress("0x00000000000000000000000000000000000000a1").Hex()
+	testAddrB = common.HexToAddress("0x00000000000000000000000000000000000000b2").Hex()
+	testAddrD = common.HexToAddress("0x00000000000000000000000000000000000000d4").Hex()
+	errDown   = errors.New("connection refused")
+)
+
+//fakeSign signature accepted by fakeVerifier for publicKey over data
+func fakeSign(publicKey string, data []byte) string {
+	digest := sha256.Sum256(append([]byte(publicKey+"\n"), data...))
+	return "SIG_FAKE_" + hex.EncodeToString(digest[:])
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) Verify(publicKey string, data []byte, signature string) bool {
+	return signature == fakeSign(publicKey, data)
+}
+
+func (fakeVerifier) VerifyRegistration(publicKey string, msg *yt.RegMessage, sigType, signature string) bool {
+	data, err := msg.SignedBytes(sigType)
+	return err == nil && signature == fakeSign(publicKey, data)
+}
+
+func (fakeVerifier) VerifyEth(ethaddr string, data []byte, signature string) bool {
+	return signature == fakeSign(ethaddr, data)
+}
+
+func (fakeVerifier) VerifyEthTypedData(domain *yt.EIP712Domain, msg *yt.RegMessage, signature string) bool {
+	return signature == fakeSign(msg.EthAddr, append([]byte("eip712\n"), msg.Bytes()...))
+}
+
+//fakeStore in-memory Store, a method returns the error in fail under its name if any
+type fakeStore struct {
+	mu     sync.Mutex
+	regs   map[string]*yt.Registry
+	nonces map[string]bool
+	fail   map[string]error
+}
+
+func (st *fakeStore) failed(method string) error {
+	return st.fail[method]
+}
+
+func (st *fakeStore) GetAccountInfo(account string) (*yt.Registry, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("GetAccountInfo"); err != nil {
+		return nil, err
+	}
+	reg, ok := st.regs[account]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	cp := *reg
+	return &cp, nil
+}
+
+func (st *fakeStore) AddLateRegistry(account, pubkey string, balance int64, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("AddLateRegistry"); err != nil {
+		return err
+	}
+	if _, ok := st.regs[account]; ok {
+		return yt.ErrAlreadyInRegistry
+	}
+	st.regs[account] = &yt.Registry{Account: account, Pubkey: pubkey, Balance: balance, Late: true}
+	return nil
+}
+
+func (st *fakeStore) UseNonce(nonce, account string, expiry int64) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("UseNonce"); err != nil {
+		return err
+	}
+	if st.nonces[nonce] {
+		return yt.ErrInvalidNonce
+	}
+	st.nonces[nonce] = true
+	return nil
+}
+
+func (st *fakeStore) RegEthAddr(account string, prev *yt.Registry, registration *yt.Registration, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("RegEthAddr"); err != nil {
+		return err
+	}
+	reg, ok := st.regs[account]
+	if !ok || reg.EthAddr != prev.EthAddr || reg.Changes != prev.Changes || reg.PayoutStatus != "" {
+		return yt.ErrRegistryChanged
+	}
+	if reg.EthAddr != "" {
+		reg.Changes++
+	}
+	reg.EthAddr = registration.EthAddr
+	reg.EthVerified = registration.EthVerified
+	reg.EthContract = registration.EthContract
+	reg.KeyDecision = registration.KeyDecision
+	return nil
+}
+
+func (st *fakeStore) SetExclude(account string, exclude bool, reason string, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("SetExclude"); err != nil {
+		return err
+	}
+	reg, ok := st.regs[account]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	reg.Exclude, reg.ExcludeReason = exclude, reason
+	return nil
+}
+
+func (st *fakeStore) OverrideEthAddr(account, ethaddr, justification string, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("OverrideEthAddr"); err != nil {
+		return err
+	}
+	reg, ok := st.regs[account]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if reg.PayoutStatus != "" {
+		return yt.ErrPayoutFrozen
+	}
+	reg.EthAddr = ethaddr
+	return nil
+}
+
+func (st *fakeStore) UpdateKeyBalance(account, pubkey string, balance int64, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("UpdateKeyBalance"); err != nil {
+		return err
+	}
+	reg, ok := st.regs[account]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if reg.PayoutStatus != "" {
+		return yt.ErrPayoutFrozen
+	}
+	reg.Pubkey, reg.Balance = pubkey, balance
+	return nil
+}
+
+func (st *fakeStore) ListAccounts(status string, skip, limit int64) ([]*yt.Registry, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("ListAccounts"); err != nil {
+		return nil, err
+	}
+	regs := make([]*yt.Registry, 0)
+	for _, reg := range st.regs {
+		switch status {
+		case yt.StatusAll:
+		case yt.StatusQueued, yt.StatusPaid:
+			if reg.PayoutStatus != status {
+				continue
+			}
+		default:
+			return nil, yt.ErrUnknownStatus
+		}
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Account < regs[j].Account })
+	if skip >= int64(len(regs)) {
+		return []*yt.Registry{}, nil
+	}
+	regs = regs[skip:]
+	if limit < int64(len(regs)) {
+		regs = regs[:limit]
+	}
+	return regs, nil
+}
+
+func (st *fakeStore) GetAccountsByEthAddr(ethaddr common.Address) ([]*yt.Registry, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("GetAccountsByEthAddr"); err != nil {
+		return nil, err
+	}
+	regs := make([]*yt.Registry, 0)
+	for _, reg := range st.regs {
+		if strings.EqualFold(reg.EthAddr, ethaddr.Hex()) {
+			regs = append(regs, reg)
+		}
+	}
+	return regs, nil
+}
+
+func (st *fakeStore) GetAccountInfos(accounts []string) ([]*yt.Registry, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("GetAccountInfos"); err != nil {
+		return nil, err
+	}
+	regs := make([]*yt.Registry, 0)
+	for _, account := range accounts {
+		if reg, ok := st.regs[account]; ok {
+			regs = append(regs, reg)
+		}
+	}
+	return regs, nil
+}
+
+func (st *fakeStore) Counts() (*yt.RegistryCounts, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("Counts"); err != nil {
+		return nil, err
+	}
+	counts := &yt.RegistryCounts{Snapshot: int64(len(st.regs)), Total: int64(len(st.regs))}
+	for _, reg := range st.regs {
+		if reg.EthAddr != "" {
+			counts.Registered++
+		} else {
+			counts.Unregistered++
+		}
+	}
+	return counts, nil
+}
+
+func (st *fakeStore) Ping() error {
+	return st.failed("Ping")
+}
+
+func (st *fakeStore) SetPayout(account, status, txHash string, block uint64, origin *yt.Origin) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.failed("SetPayout"); err != nil {
+		return err
+	}
+	reg, ok := st.regs[account]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if reg.PayoutStatus == yt.PayoutPaid {
+		return yt.ErrPayoutPaid
+	}
+	reg.PayoutStatus, reg.PayoutTx, reg.PayoutBlock = status, txHash, block
+	return nil
+}
+
+type chainAccount struct {
+	pubkey  string
+	balance int64
+	created time.Time
+}
+
+//fakeChain in-memory Chain, a method returns the error in fail under its name if any
+type fakeChain struct {
+	accounts map[string]*chainAccount
+	fail     map[string]error
+	hang     chan struct{} // Ping blocks until it is closed if not nil
+}
+
+func (c *fakeChain) account(method, account string) (*chainAccount, error) {
+	if err := c.fail[method]; err != nil {
+		return nil, err
+	}
+	acc, ok := c.accounts[account]
+	if !ok {
+		return nil, errors.New("unknown account")
+	}
+	return acc, nil
+}
+
+func (c *fakeChain) GetPubKey(account string) (string, error) {
+	acc, err := c.account("GetPubKey", account)
+	if err != nil {
+		return "", err
+	}
+	return acc.pubkey, nil
+}
+
+func (c *fakeChain) GetBalance(account string) (int64, error) {
+	acc, err := c.account("GetBalance", account)
+	if err != nil {
+		return 0, err
+	}
+	if acc.balance == 0 {
+		return 0, eostx.ErrNoBalance
+	}
+	return acc.balance, nil
+}
+
+func (c *fakeChain) GetCreated(account string) (time.Time, error) {
+	acc, err := c.account("GetCreated", account)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return acc.created, nil
+}
+
+func (c *fakeChain) Ping() error {
+	if c.hang != nil {
+		<-c.hang
+	}
+	return c.fail["Ping"]
+}
+
+//fakeCaller contract caller which finds code at contract addresses
+type fakeCaller struct {
+	contracts map[common.Address]bool
+	err       error
+}
+
+func (c *fakeCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.contracts[contract] {
+		return []byte{0x60, 0x80}, nil
+	}
+	return nil, nil
+}
+
+func (c *fakeCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+type fixture struct {
+	server *Server
+	store  *fakeStore
+	chain  *fakeChain
+	caller *fakeCaller
+}
+
+//newFixture registry server over fake store and chain:
+//alice has not registered, bob has registered testAddrB, carol is excluded, dave is queued and erin is paid,
+//frank, eosio.x, newbie, poor and broken are only on chain
+func newFixture(t *testing.T, configure func(*Config)) *fixture {
+	store := &fakeStore{
+		regs: map[string]*yt.Registry{
+			"alice": {Account: "alice", Pubkey: testKey, Balance: 100},
+			"bob":   {Account: "bob", Pubkey: testKey, Balance: 200, EthAddr: testAddrB},
+			"carol": {Account: "carol", Pubkey: testKey, Balance: 5, Exclude: true},
+			"dave":  {Account: "dave", Pubkey: testKey, Balance: 300, EthAddr: testAddrD, PayoutStatus: yt.PayoutQueued},
+			"erin":  {Account: "erin", Pubkey: testKey, Balance: 400, EthAddr: testAddrD, PayoutStatus: yt.PayoutPaid},
+		},
+		nonces: make(map[string]bool),
+		fail:   make(map[string]error),
+	}
+	old := testNow.Add(-48 * time.Hour)
+	chain := &fakeChain{
+		accounts: map[string]*chainAccount{
+			"alice":   {pubkey: testYTAKey, balance: 100, created: old},
+			"frank":   {pubkey: testYTAKey, balance: 42, created: old},
+			"eosio.x": {pubkey: testYTAKey, balance: 1, created: old},
+			"newbie":  {pubkey: testYTAKey, balance: 1, created: testNow},
+			"poor":    {pubkey: testYTAKey, created: old},
+			"broken":  {pubkey: "garbage", balance: 1, created: old},
+		},
+		fail: make(map[string]error),
+	}
+	caller := &fakeCaller{contracts: make(map[common.Address]bool)}
+	config := &Config{
+		Domain:       testDomain,
+		ChainID:      testChainID,
+		NonceTTL:     30 * time.Minute,
+		NonceKey:     []byte("nonce-key"),
+		KeyPolicy:    yt.KeyPolicySnapshot,
+		EIP712Domain: &yt.EIP712Domain{Name: testDomain, Version: "1", ChainID: 1},
+		EthCaller:    caller,
+		Distribution: yt.NewDistribution([]*yt.Registry{{Account: "bob", Balance: 200, EthAddr: testAddrB}}),
+		LatePolicy:   &yt.LatePolicy{Cutoff: testNow.Add(-time.Hour), Exclude: []string{"eosio.*"}},
+		RegPolicy:    &yt.RegPolicy{MaxChanges: -1},
+		AdminAPIKey:  testAPIKey,
+		AdminKeys:    []string{testR1Key},
+		BatchLimit:   3,
+		MaxBodyBytes: 1024,
+		MetricsToken: testToken,
+		Now:          func() time.Time { return testNow },
+	}
+	if configure != nil {
+		configure(config)
+	}
+	return &fixture{server: New(config, store, chain, fakeVerifier{}), store: store, chain: chain, caller: caller}
+}
+
+//regRequest registration of ethaddr by account with a fresh nonce signed by testKey
+func (f *fixture) regRequest(account, ethaddr string) *yt.RegRequest {
+	nonce, err := f.server.nonces.Issue(account, testNow, f.server.config.NonceTTL)
+	if err != nil {
+		panic(err.Error())
+	}
+	req := &yt.RegRequest{Account: account, EthAddr: ethaddr, Nonce: nonce.Nonce, IssuedAt: nonce.IssuedAt, Expiry: nonce.Expiry}
+	req.Sig = fakeSign(testKey, f.regMessage(req).Bytes())
+	return req
+}
+
+func (f *fixture) regMessage(req *yt.RegRequest) *yt.RegMessage {
+	return &yt.RegMessage{Domain: testDomain, ChainID: testChainID, Account: req.Account, EthAddr: req.EthAddr, Nonce: req.Nonce, IssuedAt: req.IssuedAt, Expiry: req.Expiry}
+}
+
+//signAdmin sign r with testR1Key at timestamp
+func signAdmin(r *http.Request, body []byte, timestamp int64) {
+	ts := strconv.FormatInt(timestamp, 10)
+	r.Header.Set("X-Admin-Timestamp", ts)
+	r.Header.Set("X-Admin-Signature", fakeSign(testR1Key, yt.AdminMessage(r.Method, r.URL.RequestURI(), ts, body)))
+}
+
+//apiCase request sent to a fresh fixture and the expected status and catalog code, code is empty on success
+type apiCase struct {
+	name   string
+	method string
+	target string
+	body   interface{} // string is sent as is, func(*fixture) interface{} is called, others are encoded to JSON
+	header map[string]string
+	signed bool // sign as admin
+	config func(*Config)
+	setup  func(*fixture)
+	status int
+	code   string
+	check  func(*testing.T, *fixture, *Response)
+}
+
+func encodeBody(t *testing.T, f *fixture, body interface{}) []byte {
+	if fn, ok := body.(func(*fixture) interface{}); ok {
+		body = fn(f)
+	}
+	switch b := body.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+}
+
+func (f *fixture) do(t *testing.T, c *apiCase) (*httptest.ResponseRecorder, *Response) {
+	body := encodeBody(t, f, c.body)
+	r := httptest.NewRequest(c.method, c.target, bytes.NewReader(body))
+	r.Header.Set("Accept-Language", "en")
+	if c.signed {
+		signAdmin(r, body, testNow.Unix())
+	}
+	for k, v := range c.header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	f.server.ServeHTTP(w, r)
+	resp := new(Response)
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("decode response %q: %s", w.Body.String(), err)
+		}
+	}
+	return w, resp
+}
+
+func runCases(t *testing.T, cases []apiCase) {
+	for i := range cases {
+		c := &cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			f := newFixture(t, c.config)
+			if c.setup != nil {
+				c.setup(f)
+			}
+			w, resp := f.do(t, c)
+			if w.Code != c.status || resp.Error != c.code {
+				t.Fatalf("got %d %q, want %d %q: %s", w.Code, resp.Error, c.status, c.code, w.Body.String())
+			}
+			if c.code == "" && resp.Code != 0 {
+				t.Fatalf("code of success is %d", resp.Code)
+			}
+			if c.code != "" && resp.Code != c.status {
+				t.Fatalf("code of error is %d, want %d", resp.Code, c.status)
+			}
+			if c.check != nil {
+				c.check(t, f, resp)
+			}
+		})
+	}
+}
+
+func failStore(method string, err error) func(*fixture) {
+	return func(f *fixture) { f.store.fail[method] = err }
+}
+
+func failChain(method string) func(*fixture) {
+	return func(f *fixture) { f.chain.fail[method] = errDown }
+}
+
+//withReg build registration of alice to testAddrA and modify it
+func withReg(modify func(*fixture, *yt.RegRequest)) func(*fixture) interface{} {
+	return func(f *fixture) interface{} {
+		req := f.regRequest("alice", testAddrA)
+		if modify != nil {
+			modify(f, req)
+		}
+		return req
+	}
+}
+
+//resign sign registration again after it is modified
+func resign(f *fixture, req *yt.RegRequest) {
+	data, _ := f.regMessage(req).SignedBytes(req.SigType)
+	req.Sig = fakeSign(testKey, data)
+}
+
+func TestHandleBalance(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing account", method: "GET", target: "/balance", status: 400, code: ErrAccountRequired},
+		{name: "blank account", method: "GET", target: "/balance?account=%20", status: 400, code: ErrAccountRequired},
+		{name: "not found", method: "GET", target: "/balance?account=nobody", status: 404, code: ErrAccountNotFound},
+		{name: "excluded", method: "GET", target: "/balance?account=carol", status: 404, code: ErrAccountNotFound},
+		{name: "internal error", method: "GET", target: "/balance?account=alice", setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if strings.Contains(resp.Msg, errDown.Error()) {
+					t.Fatalf("internal error is leaked: %s", resp.Msg)
+				}
+			}},
+		{name: "success", method: "GET", target: "/balance?account=alice", status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if resp.Data != float64(100) {
+					t.Fatalf("balance is %v", resp.Data)
+				}
+			}},
+	})
+}
+
+func TestHandleEthAddr(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing account", method: "GET", target: "/ethaddr", status: 400, code: ErrAccountRequired},
+		{name: "not found", method: "GET", target: "/ethaddr?account=nobody", status: 404, code: ErrAccountNotFound},
+		{name: "internal error", method: "GET", target: "/ethaddr?account=bob", setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "GET", target: "/ethaddr?account=bob", status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if resp.Data != testAddrB {
+					t.Fatalf("ethaddr is %v", resp.Data)
+				}
+			}},
+	})
+}
+
+func TestHandleNonce(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing account", method: "GET", target: "/nonce", status: 400, code: ErrAccountRequired},
+		{name: "not found", method: "GET", target: "/nonce?account=nobody", status: 404, code: ErrAccountNotFound},
+		{name: "internal error", method: "GET", target: "/nonce?account=alice", setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "GET", target: "/nonce?account=alice", status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.(map[string]interface{})
+				if data["account"] != "alice" || data["domain"] != testDomain || data["chainId"] != testChainID || data["nonce"] == "" || data["typedData"] != nil || data["esr"] != nil {
+					t.Fatalf("nonce is %v", data)
+				}
+				if len(f.store.nonces) != 0 {
+					t.Fatal("issued nonce is stored")
+				}
+			}},
+		{name: "success with typed data", method: "GET", target: "/nonce?account=alice&ethaddr=" + testAddrA, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.(map[string]interface{})
+				if data["ethaddr"] != testAddrA || data["typedData"] == nil || !strings.HasPrefix(data["esr"].(string), "esr:") {
+					t.Fatalf("nonce is %v", data)
+				}
+			}},
+		{name: "success without EIP-712 domain", method: "GET", target: "/nonce?account=alice&ethaddr=" + testAddrA, config: func(c *Config) { c.EIP712Domain = nil }, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.(map[string]interface{})
+				if data["ethaddr"] != testAddrA || data["typedData"] != nil {
+					t.Fatalf("nonce is %v", data)
+				}
+			}},
+	})
+}
+
+func TestHandleReg(t *testing.T) {
+	registered := func(ethVerified, ethContract bool) func(*testing.T, *fixture, *Response) {
+		return func(t *testing.T, f *fixture, resp *Response) {
+			reg := f.store.regs["alice"]
+			if reg.EthAddr != testAddrA || reg.EthVerified != ethVerified || reg.EthContract != ethContract || reg.KeyDecision == nil || !reg.KeyDecision.Accepted {
+				t.Fatalf("registry is %+v", reg)
+			}
+			if len(f.store.nonces) != 1 {
+				t.Fatal("nonce is not used")
+			}
+		}
+	}
+	unchanged := func(t *testing.T, f *fixture, resp *Response) {
+		if reg := f.store.regs["alice"]; reg.EthAddr != "" {
+			t.Fatalf("registry is changed: %+v", reg)
+		}
+	}
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/reg", status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/reg", body: "{", status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Account = " " }), status: 400, code: ErrAccountRequired},
+		{name: "missing ethaddr", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthAddr = "" }), status: 400, code: ErrEthAddrRequired},
+		{name: "invalid ethaddr", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthAddr = "0x1234" }), status: 400, code: ErrInvalidEthAddr},
+		{name: "missing signature", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Sig = "" }), status: 400, code: ErrSignatureRequired},
+		{name: "not found", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("nobody", testAddrA) }, status: 404, code: ErrAccountNotFound},
+		{name: "internal error of account", method: "POST", target: "/reg", body: withReg(nil), setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal},
+		{name: "already registered", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("bob", strings.ToLower(testAddrB)) }, status: 409, code: ErrAlreadyRegistered},
+		{name: "unknown signature type", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.SigType = "other" }), status: 400, code: ErrBadSigType},
+		{name: "expired message", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Expiry = testNow.Unix(); resign(f, r) }), status: 400, code: ErrInvalidMessage},
+		{name: "forged nonce", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Nonce = strings.Repeat("0", len(r.Nonce)); resign(f, r) }), status: 401, code: ErrInvalidNonce},
+		{name: "nonce of another account", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Nonce = f.regRequest("bob", testAddrA).Nonce; resign(f, r) }), status: 401, code: ErrInvalidNonce},
+		{name: "used nonce", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { f.store.nonces[r.Nonce] = true }), status: 401, code: ErrInvalidNonce, check: unchanged},
+		{name: "internal error of nonce", method: "POST", target: "/reg", body: withReg(nil), setup: failStore("UseNonce", errDown), status: 500, code: ErrInternal, check: unchanged},
+		{name: "bad eth signature type", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthSig, r.EthSigType = "0x00", "other" }), status: 400, code: ErrBadEthSigType},
+		{name: "eip712 without domain", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) {
+			r.EthSig, r.EthSigType = fakeSign(testAddrA, append([]byte("eip712\n"), f.regMessage(r).Bytes()...)), "eip712"
+		}), config: func(c *Config) { c.EIP712Domain = nil }, status: 400, code: ErrBadEthSigType},
+		{name: "bad eth signature", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthSig = "0x00" }), status: 401, code: ErrBadEthSignature, check: unchanged},
+		{name: "eth signature required", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.RequireEthSig = true }, status: 400, code: ErrEthSigRequired},
+		{name: "bad signature", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Sig = fakeSign(testR1Key, f.regMessage(r).Bytes()) }), status: 401, code: ErrBadSignature, check: unchanged},
+		{name: "signature of another address", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthAddr = testAddrD }), status: 401, code: ErrBadSignature, check: unchanged},
+		{name: "chain unavailable", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.KeyPolicy = yt.KeyPolicyChain }, setup: failChain("GetPubKey"), status: 502, code: ErrChainUnavailable},
+		{name: "bad chain key", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.KeyPolicy = yt.KeyPolicyChain }, setup: func(f *fixture) { f.chain.accounts["alice"].pubkey = "garbage" }, status: 500, code: ErrInternal},
+		{name: "chain key mismatch", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.KeyPolicy = yt.KeyPolicyBoth }, setup: func(f *fixture) { f.chain.accounts["alice"].pubkey = testR1Key }, status: 401, code: ErrBadSignature},
+		{name: "contract", method: "POST", target: "/reg", body: withReg(nil), setup: func(f *fixture) { f.caller.contracts[common.HexToAddress(testAddrA)] = true }, status: 409, code: ErrContractEthAddr, check: unchanged},
+		{name: "internal error of contract", method: "POST", target: "/reg", body: withReg(nil), setup: func(f *fixture) { f.caller.err = errDown }, status: 500, code: ErrInternal},
+		{name: "registry changed", method: "POST", target: "/reg", body: withReg(nil), setup: failStore("RegEthAddr", yt.ErrRegistryChanged), status: 409, code: ErrRegistryChanged},
+		{name: "internal error of registration", method: "POST", target: "/reg", body: withReg(nil), setup: failStore("RegEthAddr", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/reg", body: withReg(nil), status: 200, check: registered(false, false)},
+		{name: "raw signature as scatter", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.SigType = yt.SigTypeScatter }), status: 401, code: ErrBadSignature, check: unchanged},
+		{name: "raw signature as esr", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.SigType = yt.SigTypeESR }), status: 401, code: ErrBadSignature, check: unchanged},
+		{name: "success by scatter", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.SigType = yt.SigTypeScatter; resign(f, r) }), status: 200, check: registered(false, false)},
+		{name: "success by esr", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.SigType = yt.SigTypeESR; resign(f, r) }), status: 200, check: registered(false, false)},
+		{name: "success by chain key", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.KeyPolicy = yt.KeyPolicyBoth }, status: 200, check: registered(false, false)},
+		{name: "success of contract", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.AllowContract = true }), setup: func(f *fixture) { f.caller.contracts[common.HexToAddress(testAddrA)] = true }, status: 200, check: registered(false, true)},
+		{name: "success with eth signature", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.EthSig = fakeSign(testAddrA, f.regMessage(r).Bytes()) }), config: func(c *Config) { c.RequireEthSig = true }, status: 200, check: registered(true, false)},
+		{name: "success with eip712 signature", method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) {
+			r.EthSig, r.EthSigType = fakeSign(testAddrA, append([]byte("eip712\n"), f.regMessage(r).Bytes()...)), "eip712"
+		}), status: 200, check: registered(true, false)},
+	})
+}
+
+func TestHandleRegReplay(t *testing.T) {
+	f := newFixture(t, nil)
+	req := f.regRequest("alice", testAddrA)
+	c := &apiCase{method: "POST", target: "/reg", body: req}
+	if w, resp := f.do(t, c); w.Code != 200 {
+		t.Fatalf("first registration: %d %s", w.Code, resp.Error)
+	}
+	f.store.regs["alice"].EthAddr = ""
+	if w, resp := f.do(t, c); w.Code != 401 || resp.Error != ErrInvalidNonce {
+		t.Fatalf("replayed registration: %d %s", w.Code, resp.Error)
+	}
+}
+
+func TestHandleProof(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing ethaddr", method: "GET", target: "/proof", status: 400, code: ErrEthAddrRequired},
+		{name: "invalid ethaddr", method: "GET", target: "/proof?ethaddr=0x1234", status: 400, code: ErrInvalidEthAddr},
+		{name: "not in distribution", method: "GET", target: "/proof?ethaddr=" + testAddrA, status: 404, code: ErrNotInDistribution},
+		{name: "success", method: "GET", target: "/proof?ethaddr=" + strings.ToLower(testAddrB), status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				data := resp.Data.(map[string]interface{})
+				if data["merkleRoot"] != f.server.config.Distribution.Tree.Root().Hex() || len(data["claims"].([]interface{})) != 1 {
+					t.Fatalf("proof is %v", data)
+				}
+			}},
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	yt "github.com/aurawing/ytttransfer"
+)
+
+//lateRequest late registration of account signed by testKey
+func lateRequest(account string) *yt.LateRequest {
+	req := &yt.LateRequest{Account: account, IssuedAt: testNow.Unix() - 60, Expiry: testNow.Unix() + 600}
+	msg := &yt.LateRegMessage{Domain: testDomain, ChainID: testChainID, Account: account, IssuedAt: req.IssuedAt, Expiry: req.Expiry}
+	req.Sig = fakeSign(testKey, msg.Bytes())
+	return req
+}
+
+func TestHandleLate(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/late", status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/late", body: "{", status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/late", body: &yt.LateRequest{Sig: "sig"}, status: 400, code: ErrAccountRequired},
+		{name: "missing signature", method: "POST", target: "/late", body: &yt.LateRequest{Account: "frank"}, status: 400, code: ErrSignatureRequired},
+		{name: "expired message", method: "POST", target: "/late", body: &yt.LateRequest{Account: "frank", IssuedAt: testNow.Unix() - 600, Expiry: testNow.Unix(), Sig: "sig"}, status: 400, code: ErrInvalidMessage},
+		{name: "already in registry", method: "POST", target: "/late", body: lateRequest("alice"), status: 409, code: ErrAlreadyInRegistry},
+		{name: "internal error of account", method: "POST", target: "/late", body: lateRequest("frank"), setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal},
+		{name: "chain unavailable", method: "POST", target: "/late", body: lateRequest("frank"), setup: failChain("GetPubKey"), status: 502, code: ErrChainUnavailable},
+		{name: "bad chain key", method: "POST", target: "/late", body: lateRequest("broken"), status: 500, code: ErrInternal},
+		{name: "bad signature", method: "POST", target: "/late", body: func(f *fixture) interface{} { r := lateRequest("frank"); r.Sig = "sig"; return r }, status: 401, code: ErrBadSignature},
+		{name: "creation time unavailable", method: "POST", target: "/late", body: lateRequest("frank"), setup: failChain("GetCreated"), status: 502, code: ErrChainUnavailable},
+		{name: "excluded", method: "POST", target: "/late", body: lateRequest("eosio.x"), status: 403, code: ErrAccountExcluded},
+		{name: "cutoff", method: "POST", target: "/late", body: lateRequest("newbie"), status: 403, code: ErrLateCutoff},
+		{name: "no balance", method: "POST", target: "/late", body: lateRequest("poor"), status: 403, code: ErrNoBalance},
+		{name: "balance unavailable", method: "POST", target: "/late", body: lateRequest("frank"), setup: failChain("GetBalance"), status: 502, code: ErrChainUnavailable},
+		{name: "added concurrently", method: "POST", target: "/late", body: lateRequest("frank"), setup: failStore("AddLateRegistry", yt.ErrAlreadyInRegistry), status: 409, code: ErrAlreadyInRegistry},
+		{name: "internal error of registry", method: "POST", target: "/late", body: lateRequest("frank"), setup: failStore("AddLateRegistry", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/late", body: lateRequest("frank"), status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				reg := f.store.regs["frank"]
+				if resp.Data != float64(42) || reg == nil || !reg.Late || reg.Pubkey != testKey || reg.Balance != 42 {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+	})
+}
+
+func TestHandleLateDisabled(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "not found", method: "POST", target: "/late", body: lateRequest("frank"), config: func(c *Config) { c.LatePolicy = nil }, status: 404},
+	})
+}
+
+func TestHandleBalanceReadOnly(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing from snapshot", method: "GET", target: "/balance?account=frank", status: 404, code: ErrAccountNotFound,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if f.store.regs["frank"] != nil {
+					t.Fatal("GET /balance adds late registration")
+				}
+			}},
+	})
+}
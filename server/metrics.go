@@ -0,0 +1,352 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+)
+
+//latencyBuckets upper bounds in seconds of request latency histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	//SigEOS registration or late registration signed by EOS key
+	SigEOS = "eos"
+	//SigEth registration signed by ERC20 address
+	SigEth = "eth"
+	//SigAdmin admin request signed by operator key
+	SigAdmin = "admin"
+)
+
+type requestKey struct {
+	handler string
+	code    int
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+//metrics counters of registry server exposed in Prometheus text format
+type metrics struct {
+	mu            sync.Mutex
+	requests      map[requestKey]*histogram
+	sigFailures   map[string]uint64
+	registrations uint64
+	recent        []time.Time // registrations in the last minute
+}
+
+func newMetrics() *metrics {
+	return &metrics{requests: make(map[requestKey]*histogram), sigFailures: make(map[string]uint64)}
+}
+
+func (m *metrics) observeRequest(handler string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := requestKey{handler, code}
+	h, ok := m.requests[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.requests[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *metrics) sigFailure(sigType string) {
+	m.mu.Lock()
+	m.sigFailures[sigType]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) registered(now time.Time) {
+	m.mu.Lock()
+	m.registrations++
+	m.recent = append(m.trim(now), now)
+	m.mu.Unlock()
+}
+
+//trim drop registrations older than a minute
+func (m *metrics) trim(now time.Time) []time.Time {
+	i := 0
+	for i < len(m.recent) && now.Sub(m.recent[i]) >= time.Minute {
+		i++
+	}
+	m.recent = m.recent[i:]
+	return m.recent
+}
+
+const (
+	//probeTimeout max duration of each check of a probe, a check taking longer fails
+	probeTimeout = 5 * time.Second
+	//probeStaleIntervals server is not ready if the last probe finished more than this many intervals ago
+	probeStaleIntervals = 3
+)
+
+//probe results of the last readiness check and registry count, refreshed by Server.Probe
+type probe struct {
+	mu        sync.Mutex
+	interval  time.Duration // set by Server.Probe, results never go stale if zero
+	timeout   time.Duration // of each check, probeTimeout if zero
+	checked   bool
+	checkedAt time.Time
+	ready     bool
+	checks    map[string]string
+	counts    *yt.RegistryCounts
+	countErr  error
+}
+
+//statusRecorder remember status code written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.code = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+//Probe check MongoDB and EOS node and count registry accounts now and then every interval until ctx is done,
+///readyz and /metrics only serve the cached results, server is not ready before the first check
+//or when the last check finished more than probeStaleIntervals intervals ago
+func (s *Server) Probe(ctx context.Context, interval time.Duration) {
+	s.probe.mu.Lock()
+	s.probe.interval = interval
+	if s.probe.timeout == 0 && interval < probeTimeout {
+		s.probe.timeout = interval
+	}
+	s.probe.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.probeOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) probeOnce(ctx context.Context) {
+	s.probe.mu.Lock()
+	timeout := s.probe.timeout
+	s.probe.mu.Unlock()
+	if timeout == 0 {
+		timeout = probeTimeout
+	}
+	checks, ok := s.check(ctx, timeout)
+	var counts *yt.RegistryCounts
+	var err error
+	if checks["mongo"] == "ok" {
+		result := make(chan *yt.RegistryCounts, 1)
+		err = waitCheck(ctx, timeout, func() error {
+			c, err := s.store.Counts()
+			result <- c
+			return err
+		})
+		if err != nil {
+			fmt.Printf("!!! probe -> count accounts error: %s\n", err.Error())
+		} else {
+			counts = <-result
+		}
+	} else {
+		err = fmt.Errorf("mongo: %s", checks["mongo"])
+	}
+	s.probe.mu.Lock()
+	defer s.probe.mu.Unlock()
+	s.probe.checked = true
+	s.probe.checkedAt = s.config.Now()
+	s.probe.ready = ok
+	s.probe.checks = checks
+	s.probe.counts = counts
+	s.probe.countErr = err
+}
+
+//waitCheck run check in background and wait for it at most timeout or until ctx is done,
+//a check given up keeps running until it returns and its result is dropped
+func waitCheck(ctx context.Context, timeout time.Duration, check func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//handleHealthz GET /healthz liveness, always 200 while server is running without touching MongoDB or EOS node
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, r, 0, MsgOK)
+}
+
+//handleReadyz GET /readyz returns 503 unless MongoDB and EOS node were reachable at the last probe
+//and the last probe is recent
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.probe.mu.Lock()
+	checked, checkedAt, interval, ready, checks := s.probe.checked, s.probe.checkedAt, s.probe.interval, s.probe.ready, s.probe.checks
+	s.probe.mu.Unlock()
+	data := map[string]string{"mongo": "not checked", "eos": "not checked"}
+	if checked {
+		data = map[string]string{"checkedAt": checkedAt.UTC().Format(time.RFC3339)}
+		for k, v := range checks {
+			data[k] = v
+		}
+		if interval > 0 && s.config.Now().Sub(checkedAt) > probeStaleIntervals*interval {
+			data["probe"] = "stale"
+			ready = false
+		}
+	}
+	if !ready {
+		status, msg := localize(r, ErrNotReady, "")
+		writeJSON(w, status, &Response{Code: status, Error: ErrNotReady, Data: data, Msg: msg})
+		return
+	}
+	writeOK(w, r, data, MsgOK)
+}
+
+func (s *Server) check(ctx context.Context, timeout time.Duration) (map[string]string, bool) {
+	checks := map[string]string{"mongo": "ok", "eos": "ok"}
+	ok := true
+	if err := waitCheck(ctx, timeout, s.store.Ping); err != nil {
+		checks["mongo"] = err.Error()
+		ok = false
+	}
+	if err := waitCheck(ctx, timeout, s.chain.Ping); err != nil {
+		checks["eos"] = err.Error()
+		ok = false
+	}
+	return checks, ok
+}
+
+//MetricsHandler handler of metrics in Prometheus text format to be served on a separate private listener
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(s.handleMetrics)
+}
+
+//metricsAuth require MetricsToken as bearer token
+func (s *Server) metricsAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.MetricsToken)) != 1 {
+			writeError(w, r, ErrUnauthorized, "")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+//handleMetrics GET /metrics exposes metrics in Prometheus text format, registry counts are taken from the last probe
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	m := s.metrics
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].code < keys[j].code
+	})
+	writeMetricHeader(buf, "ytt_http_requests_total", "counter", "HTTP requests by handler and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(buf, "ytt_http_requests_total{handler=%q,code=\"%d\"} %d\n", key.handler, key.code, m.requests[key].count)
+	}
+	writeMetricHeader(buf, "ytt_http_request_duration_seconds", "histogram", "Latency of HTTP requests by handler and status code.")
+	for _, key := range keys {
+		h := m.requests[key]
+		labels := fmt.Sprintf("handler=%q,code=\"%d\"", key.handler, key.code)
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(buf, "ytt_http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(buf, "ytt_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(buf, "ytt_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "ytt_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+	writeMetricHeader(buf, "ytt_signature_failures_total", "counter", "Failed signature verifications by signature type.")
+	for _, sigType := range []string{SigEOS, SigEth, SigAdmin} {
+		fmt.Fprintf(buf, "ytt_signature_failures_total{type=%q} %d\n", sigType, m.sigFailures[sigType])
+	}
+	writeMetricHeader(buf, "ytt_registrations_total", "counter", "ERC20 addresses registered since start.")
+	fmt.Fprintf(buf, "ytt_registrations_total %d\n", m.registrations)
+	writeMetricHeader(buf, "ytt_registrations_last_minute", "gauge", "ERC20 addresses registered in the last minute.")
+	fmt.Fprintf(buf, "ytt_registrations_last_minute %d\n", len(m.trim(s.config.Now())))
+	m.mu.Unlock()
+
+	stats := s.RateLimitStats()
+	writeMetricHeader(buf, "ytt_rate_limit_requests_total", "counter", "Requests checked by rate limiter by scope and result.")
+	fmt.Fprintf(buf, "ytt_rate_limit_requests_total{scope=\"ip\",result=\"allowed\"} %d\n", stats.IPAllowed)
+	fmt.Fprintf(buf, "ytt_rate_limit_requests_total{scope=\"ip\",result=\"limited\"} %d\n", stats.IPLimited)
+	fmt.Fprintf(buf, "ytt_rate_limit_requests_total{scope=\"account\",result=\"allowed\"} %d\n", stats.AccountAllowed)
+	fmt.Fprintf(buf, "ytt_rate_limit_requests_total{scope=\"account\",result=\"limited\"} %d\n", stats.AccountLimited)
+
+	s.probe.mu.Lock()
+	counts, err, checked, checkedAt := s.probe.counts, s.probe.countErr, s.probe.checked, s.probe.checkedAt
+	if !checked {
+		err = fmt.Errorf("not probed")
+	}
+	s.probe.mu.Unlock()
+	if checked {
+		writeMetricHeader(buf, "ytt_probe_timestamp_seconds", "gauge", "Unix time when the last probe finished.")
+		fmt.Fprintf(buf, "ytt_probe_timestamp_seconds %d\n", checkedAt.Unix())
+	}
+	if err == nil {
+		writeMetricHeader(buf, "ytt_snapshot_accounts", "gauge", "Accounts in snapshot.")
+		fmt.Fprintf(buf, "ytt_snapshot_accounts %d\n", counts.Snapshot)
+		writeMetricHeader(buf, "ytt_registry_accounts", "gauge", "Accounts in registry by status.")
+		for _, c := range []struct {
+			status string
+			n      int64
+		}{{"all", counts.Total}, {yt.StatusRegistered, counts.Registered}, {yt.StatusUnregistered, counts.Unregistered}, {yt.StatusExcluded, counts.Excluded}, {yt.StatusLate, counts.Late}, {yt.StatusQueued, counts.Queued}, {yt.StatusPaid, counts.Paid}} {
+			fmt.Fprintf(buf, "ytt_registry_accounts{status=%q} %d\n", c.status, c.n)
+		}
+	}
+	writeMetricHeader(buf, "ytt_metrics_scrape_error", "gauge", "1 if registry counts could not be read at the last probe.")
+	if err != nil {
+		fmt.Fprintf(buf, "ytt_metrics_scrape_error 1\n")
+	} else {
+		fmt.Fprintf(buf, "ytt_metrics_scrape_error 0\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, strings.TrimSpace(help), name, typ)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	f := newFixture(t, nil)
+	healthz := &apiCase{method: "GET", target: "/healthz"}
+	readyz := &apiCase{method: "GET", target: "/readyz"}
+	f.store.fail["Ping"] = errDown
+	f.chain.fail["Ping"] = errDown
+	if w, resp := f.do(t, healthz); w.Code != 200 || resp.Error != "" {
+		t.Fatalf("healthz while down: %d %s", w.Code, resp.Error)
+	}
+	if w, resp := f.do(t, readyz); w.Code != 503 || resp.Error != ErrNotReady {
+		t.Fatalf("readyz before probe: %d %s", w.Code, resp.Error)
+	}
+	f.server.probeOnce(context.Background())
+	if w, resp := f.do(t, readyz); w.Code != 503 || resp.Error != ErrNotReady {
+		t.Fatalf("readyz while down: %d %s", w.Code, resp.Error)
+	}
+	delete(f.store.fail, "Ping")
+	delete(f.chain.fail, "Ping")
+	if w, resp := f.do(t, readyz); w.Code != 503 {
+		t.Fatalf("readyz is not cached: %d %s", w.Code, resp.Error)
+	}
+	f.server.probeOnce(context.Background())
+	if w, resp := f.do(t, readyz); w.Code != 200 || resp.Error != "" {
+		t.Fatalf("readyz while up: %d %s", w.Code, resp.Error)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	f := newFixture(t, nil)
+	f.chain.hang = make(chan struct{})
+	defer close(f.chain.hang)
+	f.server.probe.timeout = 10 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		f.server.probeOnce(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe waits for a hanging check")
+	}
+	w, resp := f.do(t, &apiCase{method: "GET", target: "/readyz"})
+	if data, _ := resp.Data.(map[string]interface{}); w.Code != 503 || data["eos"] != context.DeadlineExceeded.Error() || data["mongo"] != "ok" {
+		t.Fatalf("readyz with hanging EOS node: %d %v", w.Code, resp.Data)
+	}
+}
+
+func TestProbeStale(t *testing.T) {
+	f := newFixture(t, nil)
+	f.server.probe.interval = time.Minute
+	f.server.probeOnce(context.Background())
+	readyz := &apiCase{method: "GET", target: "/readyz"}
+	w, resp := f.do(t, readyz)
+	if data, _ := resp.Data.(map[string]interface{}); w.Code != 200 || data["checkedAt"] != testNow.UTC().Format(time.RFC3339) {
+		t.Fatalf("readyz after probe: %d %v", w.Code, resp.Data)
+	}
+	f.server.config.Now = func() time.Time { return testNow.Add(probeStaleIntervals * time.Minute) }
+	if w, resp := f.do(t, readyz); w.Code != 200 {
+		t.Fatalf("readyz within %d intervals: %d %v", probeStaleIntervals, w.Code, resp.Data)
+	}
+	f.server.config.Now = func() time.Time { return testNow.Add(probeStaleIntervals*time.Minute + time.Second) }
+	w, resp = f.do(t, readyz)
+	if data, _ := resp.Data.(map[string]interface{}); w.Code != 503 || resp.Error != ErrNotReady || data["probe"] != "stale" {
+		t.Fatalf("readyz after %d intervals: %d %v", probeStaleIntervals, w.Code, resp.Data)
+	}
+}
+
+func TestProbeStopsWithContext(t *testing.T) {
+	f := newFixture(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.server.Probe(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Probe does not return when context is done")
+	}
+	f.server.probe.mu.Lock()
+	defer f.server.probe.mu.Unlock()
+	if !f.server.probe.checked {
+		t.Fatal("Probe does not check before waiting")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	scrape := func(f *fixture, h http.Handler, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	runCases(t, []apiCase{
+		{name: "missing token", method: "GET", target: "/metrics", status: 401, code: ErrUnauthorized},
+		{name: "bad token", method: "GET", target: "/metrics", header: map[string]string{"Authorization": "Bearer wrong"}, status: 401, code: ErrUnauthorized},
+		{name: "disabled", method: "GET", target: "/metrics", header: map[string]string{"Authorization": "Bearer " + testToken}, config: func(c *Config) { c.MetricsToken = "" }, status: 404},
+	})
+
+	f := newFixture(t, nil)
+	auth := map[string]string{"Authorization": "Bearer " + testToken}
+	if w := scrape(f, f.server, auth); w.Code != 200 || !strings.Contains(w.Body.String(), "ytt_metrics_scrape_error 1") {
+		t.Fatalf("metrics before probe: %d %s", w.Code, w.Body.String())
+	}
+	f.server.probeOnce(context.Background())
+	f.store.fail["Counts"] = errDown
+	for _, h := range []http.Handler{f.server, f.server.MetricsHandler()} {
+		w := scrape(f, h, auth)
+		if w.Code != 200 || !strings.Contains(w.Body.String(), `ytt_registry_accounts{status="registered"} 3`) || !strings.Contains(w.Body.String(), "ytt_metrics_scrape_error 0") ||
+			!strings.Contains(w.Body.String(), "ytt_probe_timestamp_seconds "+strconv.FormatInt(testNow.Unix(), 10)) {
+			t.Fatalf("metrics after probe: %d %s", w.Code, w.Body.String())
+		}
+	}
+}
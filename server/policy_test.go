@@ -0,0 +1,25 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegPolicy(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "nonce not open", method: "GET", target: "/nonce?account=alice", config: func(c *Config) { c.RegPolicy.Open = testNow.Add(time.Hour) }, status: 403, code: ErrRegNotOpen},
+		{name: "nonce closed", method: "GET", target: "/nonce?account=alice", config: func(c *Config) { c.RegPolicy.Close = testNow }, status: 403, code: ErrRegClosed},
+		{name: "nonce frozen", method: "GET", target: "/nonce?account=dave", status: 409, code: ErrPayoutFrozen},
+		{name: "reg not open", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.RegPolicy.Open = testNow.Add(time.Hour) }, status: 403, code: ErrRegNotOpen},
+		{name: "reg closed", method: "POST", target: "/reg", body: withReg(nil), config: func(c *Config) { c.RegPolicy.Close = testNow }, status: 403, code: ErrRegClosed},
+		{name: "reg change limit", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("bob", testAddrA) }, config: func(c *Config) { c.RegPolicy.MaxChanges = 0 }, status: 409, code: ErrChangeLimit},
+		{name: "reg change closed", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("bob", testAddrA) }, config: func(c *Config) { c.RegPolicy.ChangeDeadline = testNow }, status: 403, code: ErrChangeClosed},
+		{name: "reg frozen", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("dave", testAddrA) }, status: 409, code: ErrPayoutFrozen},
+		{name: "reg change", method: "POST", target: "/reg", body: func(f *fixture) interface{} { return f.regRequest("bob", testAddrA) }, config: func(c *Config) { c.RegPolicy.MaxChanges = 1 }, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if reg := f.store.regs["bob"]; reg.EthAddr != testAddrA || reg.Changes != 1 {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+	})
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//sweepInterval how often idle buckets are removed
+const sweepInterval = time.Minute
+
+//RateLimit token bucket settings, limiting is disabled if Rate is not positive
+type RateLimit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // capacity of bucket
+}
+
+//RateLimitStats counters of rate limiting
+type RateLimitStats struct {
+	IPAllowed      uint64 `json:"ipAllowed"`
+	IPLimited      uint64 `json:"ipLimited"`
+	AccountAllowed uint64 `json:"accountAllowed"`
+	AccountLimited uint64 `json:"accountLimited"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//limiter token buckets keyed by client IP or account
+type limiter struct {
+	allowed uint64 // first for 64-bit alignment of atomic access
+	limited uint64
+	limit   RateLimit
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newLimiter(limit RateLimit, now func() time.Time) *limiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &limiter{limit: limit, now: now, buckets: make(map[string]*bucket), swept: now()}
+}
+
+//allow take a token from bucket of key, returns how long to wait for next token if bucket is empty
+func (l *limiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	now := l.now()
+	burst := float64(l.limit.Burst)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		atomic.AddUint64(&l.limited, 1)
+		return false, time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	atomic.AddUint64(&l.allowed, 1)
+	return true, 0
+}
+
+//sweep remove buckets which have been refilled, they are the same as new buckets
+func (l *limiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+func (l *limiter) counters() (uint64, uint64) {
+	if l == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&l.allowed), atomic.LoadUint64(&l.limited)
+}
+
+//RateLimitStats counters of per-IP and per-account rate limiting
+func (s *Server) RateLimitStats() *RateLimitStats {
+	stats := new(RateLimitStats)
+	stats.IPAllowed, stats.IPLimited = s.ipLimiter.counters()
+	stats.AccountAllowed, stats.AccountLimited = s.accountLimiter.counters()
+	return stats
+}
+
+//limitAccount take a token of account for a query, writes 429 response and returns false if account is rate limited
+func (s *Server) limitAccount(w http.ResponseWriter, r *http.Request, account string) bool {
+	return s.limitKey(w, r, account, account)
+}
+
+//limitSigned take a token of account for a request whose signature is verified, its bucket is apart from queries
+//which anybody can send in the name of account
+func (s *Server) limitSigned(w http.ResponseWriter, r *http.Request, account string) bool {
+	return s.limitKey(w, r, "signed:"+account, account)
+}
+
+func (s *Server) limitKey(w http.ResponseWriter, r *http.Request, key, account string) bool {
+	ok, wait := s.accountLimiter.allow(key)
+	if !ok {
+		writeRateLimited(w, r, wait)
+		fmt.Printf("!!! rate limited: account %s from %s on %s\n", account, s.clientIP(r), r.URL.Path)
+	}
+	return ok
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, r, ErrRateLimited, "")
+}
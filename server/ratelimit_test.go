@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	yt "github.com/aurawing/ytttransfer"
+)
+
+func TestRateLimit(t *testing.T) {
+	accountLimit := func(c *Config) { c.AccountLimit = RateLimit{Rate: 0.001, Burst: 1} }
+	t.Run("ip", func(t *testing.T) {
+		f := newFixture(t, func(c *Config) { c.IPLimit = RateLimit{Rate: 0.001, Burst: 1} })
+		c := &apiCase{method: "GET", target: "/balance?account=alice"}
+		if w, _ := f.do(t, c); w.Code != 200 {
+			t.Fatalf("first request: %d", w.Code)
+		}
+		w, resp := f.do(t, c)
+		if w.Code != 429 || resp.Error != ErrRateLimited || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("second request: %d %s", w.Code, resp.Error)
+		}
+		for _, target := range []string{"/healthz", "/readyz"} {
+			if w, resp := f.do(t, &apiCase{method: "GET", target: target}); resp.Error == ErrRateLimited {
+				t.Fatalf("%s is rate limited: %d", target, w.Code)
+			}
+		}
+		if w, resp := f.do(t, &apiCase{method: "GET", target: "/metrics", header: map[string]string{"Authorization": "Bearer " + testToken}}); resp.Error != ErrRateLimited {
+			t.Fatalf("/metrics is not rate limited: %d", w.Code)
+		}
+	})
+	t.Run("account", func(t *testing.T) {
+		f := newFixture(t, accountLimit)
+		if w, _ := f.do(t, &apiCase{method: "GET", target: "/status?account=alice"}); w.Code != 200 {
+			t.Fatalf("first query: %d", w.Code)
+		}
+		if w, resp := f.do(t, &apiCase{method: "GET", target: "/balance?account=alice"}); w.Code != 429 || resp.Error != ErrRateLimited {
+			t.Fatalf("second query: %d %s", w.Code, resp.Error)
+		}
+		if w, _ := f.do(t, &apiCase{method: "GET", target: "/balance?account=bob"}); w.Code != 200 {
+			t.Fatalf("query of another account: %d", w.Code)
+		}
+	})
+	t.Run("batch charges each account", func(t *testing.T) {
+		f := newFixture(t, accountLimit)
+		if w, resp := f.do(t, &apiCase{method: "POST", target: "/batch", body: &BatchRequest{Accounts: []string{"alice", "alice"}}}); w.Code != 429 || resp.Error != ErrRateLimited {
+			t.Fatalf("batch: %d %s", w.Code, resp.Error)
+		}
+	})
+	t.Run("queries do not lock out registration", func(t *testing.T) {
+		f := newFixture(t, accountLimit)
+		f.do(t, &apiCase{method: "GET", target: "/balance?account=alice"})
+		if w, resp := f.do(t, &apiCase{method: "GET", target: "/balance?account=alice"}); w.Code != 429 {
+			t.Fatalf("second query: %d %s", w.Code, resp.Error)
+		}
+		if w, resp := f.do(t, &apiCase{method: "POST", target: "/reg", body: withReg(func(f *fixture, r *yt.RegRequest) { r.Sig = "sig" })}); w.Code != 401 || resp.Error != ErrBadSignature {
+			t.Fatalf("unsigned registration: %d %s", w.Code, resp.Error)
+		}
+		if w, resp := f.do(t, &apiCase{method: "POST", target: "/reg", body: withReg(nil)}); w.Code != 200 {
+			t.Fatalf("registration: %d %s", w.Code, resp.Error)
+		}
+		f.store.regs["alice"].EthAddr = ""
+		if w, resp := f.do(t, &apiCase{method: "POST", target: "/reg", body: withReg(nil)}); w.Code != 429 || resp.Error != ErrRateLimited {
+			t.Fatalf("second registration: %d %s", w.Code, resp.Error)
+		}
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(t, func(c *Config) { c.ProxyHeader, c.TrustedProxies = "X-Forwarded-For", proxies })
+	for _, c := range []struct {
+		remote, header, want string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+		{"10.1.2.3:1234", "203.0.113.9, 198.51.100.1", "198.51.100.1"},
+		{"[2001:db8::1]:1234", "198.51.100.1", "198.51.100.1"},
+		{"[2001:db8::2]:1234", "198.51.100.1", "2001:db8::2"},
+	} {
+		r := httptest.NewRequest("GET", "/balance", nil)
+		r.RemoteAddr = c.remote
+		if c.header != "" {
+			r.Header.Set("X-Forwarded-For", c.header)
+		}
+		if got := f.server.clientIP(r); got != c.want {
+			t.Fatalf("client IP of %s with %q is %s, want %s", c.remote, c.header, got, c.want)
+		}
+	}
+
+	f = newFixture(t, func(c *Config) { c.ProxyHeader, c.IPLimit = "X-Forwarded-For", RateLimit{Rate: 0.001, Burst: 1} })
+	for i := 0; i < 2; i++ {
+		w, resp := f.do(t, &apiCase{method: "GET", target: "/balance?account=alice", header: map[string]string{"X-Forwarded-For": "198.51.100." + strconv.Itoa(i)}})
+		if i == 1 && (w.Code != 429 || resp.Error != ErrRateLimited) {
+			t.Fatalf("spoofed proxy header escapes rate limit: %d %s", w.Code, resp.Error)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 127.0.0.1 ,::1,,192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 3 || proxies[0].String() != "127.0.0.1/32" || proxies[1].String() != "::1/128" || proxies[2].String() != "192.168.0.0/16" {
+		t.Fatalf("proxies are %v", proxies)
+	}
+	if proxies, err := ParseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Fatalf("empty proxies are %v %v", proxies, err)
+	}
+	for _, s := range []string{"localhost", "10.0.0.0/33", "10.0.0.1/"} {
+		if _, err := ParseTrustedProxies(s); err == nil {
+			t.Fatalf("%q is accepted", s)
+		}
+	}
+}
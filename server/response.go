@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	yt "github.com/aurawing/ytttransfer"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//Response envelope of all registry API responses, code is 0 on success and the HTTP status otherwise
+type Response struct {
+	Code  int         `json:"code"`
+	Error string      `json:"error,omitempty"`
+	Data  interface{} `json:"data"`
+	Msg   string      `json:"msg"`
+}
+
+//message entry of message catalog
+type message struct {
+	Status int
+	ZH     string
+	EN     string
+}
+
+const (
+	MsgOK                = "OK"
+	MsgRegistered        = "REGISTERED"
+	MsgLateRegistered    = "LATE_REGISTERED"
+	ErrBadRequest        = "BAD_REQUEST"
+	ErrMethodNotAllowed  = "METHOD_NOT_ALLOWED"
+	ErrUnauthorized      = "UNAUTHORIZED"
+	ErrReasonRequired    = "REASON_REQUIRED"
+	ErrBatchTooLarge     = "BATCH_TOO_LARGE"
+	ErrBodyTooLarge      = "BODY_TOO_LARGE"
+	ErrAccountRequired   = "ACCOUNT_REQUIRED"
+	ErrAccountNotFound   = "ACCOUNT_NOT_FOUND"
+	ErrEthAddrRequired   = "ETHADDR_REQUIRED"
+	ErrInvalidEthAddr    = "INVALID_ETHADDR"
+	ErrContractEthAddr   = "CONTRACT_ETHADDR"
+	ErrSignatureRequired = "SIGNATURE_REQUIRED"
+	ErrBadSigType        = "BAD_SIG_TYPE"
+	ErrBadSignature      = "BAD_SIGNATURE"
+	ErrEthSigRequired    = "ETH_SIGNATURE_REQUIRED"
+	ErrBadEthSigType     = "BAD_ETH_SIG_TYPE"
+	ErrBadEthSignature   = "BAD_ETH_SIGNATURE"
+	ErrInvalidMessage    = "INVALID_MESSAGE"
+	ErrInvalidNonce      = "INVALID_NONCE"
+	ErrAlreadyRegistered = "ALREADY_REGISTERED"
+	ErrChangeLimit       = "CHANGE_LIMIT"
+	ErrRegNotOpen        = "REGISTRATION_NOT_OPEN"
+	ErrRegClosed         = "REGISTRATION_CLOSED"
+	ErrChangeClosed      = "CHANGE_CLOSED"
+	ErrPayoutFrozen      = "PAYOUT_FROZEN"
+	ErrAlreadyPaid       = "ALREADY_PAID"
+	ErrRegistryChanged   = "REGISTRY_CHANGED"
+	ErrAlreadyInRegistry = "ALREADY_IN_REGISTRY"
+	ErrAccountExcluded   = "ACCOUNT_EXCLUDED"
+	ErrLateCutoff        = "LATE_CUTOFF"
+	ErrNoBalance         = "NO_BALANCE"
+	ErrNotInDistribution = "NOT_IN_DISTRIBUTION"
+	ErrChainUnavailable  = "CHAIN_UNAVAILABLE"
+	ErrNotReady          = "NOT_READY"
+	ErrRateLimited       = "RATE_LIMITED"
+	ErrInternal          = "INTERNAL_ERROR"
+)
+
+var catalog = map[string]message{
+	MsgOK:                {http.StatusOK, "请求成功", "Success"},
+	MsgRegistered:        {http.StatusOK, "ERC20地址注册成功", "ERC20 address registered"},
+	MsgLateRegistered:    {http.StatusOK, "账号补登记成功", "Account added to registry"},
+	ErrBadRequest:        {http.StatusBadRequest, "参数格式不正确", "Malformed request"},
+	ErrMethodNotAllowed:  {http.StatusMethodNotAllowed, "请求方法不支持", "Method not allowed"},
+	ErrUnauthorized:      {http.StatusUnauthorized, "身份认证失败", "Authentication failed"},
+	ErrReasonRequired:    {http.StatusBadRequest, "原因不能为空", "Reason is required"},
+	ErrBatchTooLarge:     {http.StatusRequestEntityTooLarge, "批量查询账号数量超过上限", "Too many accounts in batch query, limit"},
+	ErrBodyTooLarge:      {http.StatusRequestEntityTooLarge, "请求内容过大", "Request body is too large"},
+	ErrAccountRequired:   {http.StatusBadRequest, "账号不能为空", "Account is required"},
+	ErrAccountNotFound:   {http.StatusNotFound, "账号不存在", "Account not found"},
+	ErrEthAddrRequired:   {http.StatusBadRequest, "ERC20钱包地址不能为空", "ERC20 address is required"},
+	ErrInvalidEthAddr:    {http.StatusBadRequest, "ERC20钱包地址无效", "Invalid ERC20 address"},
+	ErrContractEthAddr:   {http.StatusConflict, "ERC20钱包地址是合约地址（如交易所或代币合约），代币可能无法取回，确认无误请设置allowContract后重新提交", "ERC20 address is a contract (e.g. an exchange or token contract) and tokens may be lost, set allowContract and resubmit if you are sure"},
+	ErrSignatureRequired: {http.StatusBadRequest, "签名不能为空", "Signature is required"},
+	ErrBadSigType:        {http.StatusBadRequest, "签名类型不正确", "Unknown signature type"},
+	ErrBadSignature:      {http.StatusUnauthorized, "签名验证失败", "Signature verification failed"},
+	ErrEthSigRequired:    {http.StatusBadRequest, "ERC20地址签名不能为空", "Signature of ERC20 address is required"},
+	ErrBadEthSigType:     {http.StatusBadRequest, "ERC20地址签名类型不正确", "Unknown signature type of ERC20 address"},
+	ErrBadEthSignature:   {http.StatusUnauthorized, "ERC20地址签名验证失败", "Signature verification of ERC20 address failed"},
+	ErrInvalidMessage:    {http.StatusBadRequest, "注册消息无效", "Invalid registration message"},
+	ErrInvalidNonce:      {http.StatusUnauthorized, "nonce无效、已过期或已被使用", "Nonce is invalid, expired or already used"},
+	ErrAlreadyRegistered: {http.StatusConflict, "该账号已注册此ERC20地址", "Account has already registered this ERC20 address"},
+	ErrChangeLimit:       {http.StatusConflict, "ERC20地址修改次数已达上限", "ERC20 address cannot be changed any more"},
+	ErrRegNotOpen:        {http.StatusForbidden, "注册尚未开始", "Registration is not open yet"},
+	ErrRegClosed:         {http.StatusForbidden, "注册已结束", "Registration is closed"},
+	ErrChangeClosed:      {http.StatusForbidden, "ERC20地址修改已截止", "ERC20 address cannot be changed after deadline"},
+	ErrPayoutFrozen:      {http.StatusConflict, "该账号已进入发放队列，ERC20地址已冻结", "Account is queued for payout and its ERC20 address is frozen"},
+	ErrAlreadyPaid:       {http.StatusConflict, "该账号已完成发放，发放状态不能再修改", "Account has been paid and its payout state cannot be changed"},
+	ErrRegistryChanged:   {http.StatusConflict, "登记信息已被修改，请重试", "Registry entry is modified concurrently, please retry"},
+	ErrAlreadyInRegistry: {http.StatusConflict, "账号已在快照登记中", "Account is already in registry"},
+	ErrAccountExcluded:   {http.StatusForbidden, "该账号不允许补登记", "Account is excluded from late registration"},
+	ErrLateCutoff:        {http.StatusForbidden, "账号创建时间晚于补登记截止时间", "Account is created after cutoff of late registration"},
+	ErrNoBalance:         {http.StatusForbidden, "账号没有YTT余额", "Account has no YTT balance"},
+	ErrNotInDistribution: {http.StatusNotFound, "该地址不在分发列表中", "Address is not in the distribution"},
+	ErrRateLimited:       {http.StatusTooManyRequests, "请求过于频繁，请稍后再试", "Too many requests, please retry later"},
+	ErrNotReady:          {http.StatusServiceUnavailable, "服务未就绪", "Service is not ready"},
+	ErrChainUnavailable:  {http.StatusBadGateway, "获取链上数据失败", "Failed to fetch data from chain"},
+	ErrInternal:          {http.StatusInternalServerError, "服务器内部错误", "Internal server error"},
+}
+
+//language pick zh or en from Accept-Language header, zh is the default
+func language(r *http.Request) string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	tags := make([]tag, 0)
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		t := tag{lang: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					t.q = q
+				}
+			}
+		}
+		tags = append(tags, t)
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if strings.HasPrefix(t.lang, "zh") {
+			return "zh"
+		}
+		if strings.HasPrefix(t.lang, "en") {
+			return "en"
+		}
+	}
+	return "zh"
+}
+
+//localize message of code in language of request, detail is appended if not empty
+func localize(r *http.Request, code string, detail string) (int, string) {
+	m, ok := catalog[code]
+	if !ok {
+		m = catalog[ErrInternal]
+	}
+	msg := m.ZH
+	if language(r) == "en" {
+		msg = m.EN
+	}
+	if detail != "" {
+		msg = msg + ": " + detail
+	}
+	return m.Status, msg
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp *Response) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	b, err := json.Marshal(resp)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(&Response{Code: status, Error: ErrInternal, Msg: err.Error()})
+	}
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+//writeOK write a successful response with data and message of code
+func writeOK(w http.ResponseWriter, r *http.Request, data interface{}, code string) {
+	status, msg := localize(r, code, "")
+	writeJSON(w, status, &Response{Code: 0, Data: data, Msg: msg})
+}
+
+//writeError write an error response of code with optional detail, detail must not carry internal errors
+func writeError(w http.ResponseWriter, r *http.Request, code string, detail string) {
+	status, msg := localize(r, code, detail)
+	writeJSON(w, status, &Response{Code: status, Error: code, Msg: msg})
+}
+
+//bodyTooLarge whether err is returned by reading a request body over the limit of http.MaxBytesReader
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+//writeBodyError write BODY_TOO_LARGE if request body is over the limit, BAD_REQUEST otherwise
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	if bodyTooLarge(err) {
+		writeError(w, r, ErrBodyTooLarge, "")
+		return
+	}
+	writeError(w, r, ErrBadRequest, "")
+}
+
+//writeAccountError write ACCOUNT_NOT_FOUND if account is not in registry, INTERNAL_ERROR otherwise,
+//the error itself is only logged by caller
+func writeAccountError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == mongo.ErrNoDocuments {
+		writeError(w, r, ErrAccountNotFound, "")
+		return
+	}
+	writeError(w, r, ErrInternal, "")
+}
+
+//writePolicyError write error of registration policy
+func writePolicyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case yt.ErrRegNotOpen:
+		writeError(w, r, ErrRegNotOpen, "")
+	case yt.ErrRegClosed:
+		writeError(w, r, ErrRegClosed, "")
+	case yt.ErrChangeLimit:
+		writeError(w, r, ErrChangeLimit, "")
+	case yt.ErrChangeClosed:
+		writeError(w, r, ErrChangeClosed, "")
+	case yt.ErrPayoutFrozen:
+		writeError(w, r, ErrPayoutFrozen, "")
+	default:
+		writeError(w, r, ErrInternal, "")
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	yt "github.com/aurawing/ytttransfer"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//Store registry storage used by server, implemented by *ytttransfer.Mongoc
+type Store interface {
+	GetAccountInfo(account string) (*yt.Registry, error)
+	AddLateRegistry(account, pubkey string, balance int64, origin *yt.Origin) error
+	UseNonce(nonce, account string, expiry int64) error
+	RegEthAddr(account string, prev *yt.Registry, registration *yt.Registration, origin *yt.Origin) error
+	SetExclude(account string, exclude bool, reason string, origin *yt.Origin) error
+	OverrideEthAddr(account, ethaddr, justification string, origin *yt.Origin) error
+	UpdateKeyBalance(account, pubkey string, balance int64, origin *yt.Origin) error
+	ListAccounts(status string, skip, limit int64) ([]*yt.Registry, error)
+	GetAccountsByEthAddr(ethaddr common.Address) ([]*yt.Registry, error)
+	GetAccountInfos(accounts []string) ([]*yt.Registry, error)
+	Counts() (*yt.RegistryCounts, error)
+	Ping() error
+	SetPayout(account, status, txHash string, block uint64, origin *yt.Origin) error
+}
+
+//Chain EOS client used by server, implemented by *eostx.Eostx
+type Chain interface {
+	GetPubKey(account string) (string, error)
+	GetBalance(account string) (int64, error)
+	GetCreated(account string) (time.Time, error)
+	Ping() error
+}
+
+//Verifier signature verification used by server
+type Verifier interface {
+	Verify(publicKey string, data []byte, signature string) bool
+	VerifyRegistration(publicKey string, msg *yt.RegMessage, sigType, signature string) bool
+	VerifyEth(ethaddr string, data []byte, signature string) bool
+	VerifyEthTypedData(domain *yt.EIP712Domain, msg *yt.RegMessage, signature string) bool
+}
+
+//SigVerifier Verifier implemented by signature functions of ytttransfer package
+type SigVerifier struct{}
+
+//Verify see ytttransfer.Verify
+func (SigVerifier) Verify(publicKey string, data []byte, signature string) bool {
+	return yt.Verify(publicKey, data, signature)
+}
+
+//VerifyRegistration see ytttransfer.VerifyRegistration
+func (SigVerifier) VerifyRegistration(publicKey string, msg *yt.RegMessage, sigType, signature string) bool {
+	return yt.VerifyRegistration(publicKey, msg, sigType, signature)
+}
+
+//VerifyEth see ytttransfer.VerifyEth
+func (SigVerifier) VerifyEth(ethaddr string, data []byte, signature string) bool {
+	return yt.VerifyEth(ethaddr, data, signature)
+}
+
+//VerifyEthTypedData see ytttransfer.VerifyEthTypedData
+func (SigVerifier) VerifyEthTypedData(domain *yt.EIP712Domain, msg *yt.RegMessage, signature string) bool {
+	return yt.VerifyEthTypedData(domain, msg, signature)
+}
+
+//DefaultBatchLimit default max accounts of a batch query
+const DefaultBatchLimit = 1000
+
+//Config settings of registry server
+type Config struct {
+	Domain         string              // domain of registration messages
+	ChainID        string              // EOS chain ID of registration messages
+	NonceTTL       time.Duration       // validity period of nonces
+	NonceKey       []byte              // HMAC key of nonces, random if empty
+	RequireEthSig  bool                // registration must be signed by ERC20 address too
+	KeyPolicy      string              // which key must sign registrations
+	EIP712Domain   *yt.EIP712Domain    // domain of EIP-712 signatures, no typed data is issued and eip712 signatures are rejected if nil
+	EthCaller      bind.ContractCaller // detect contract addresses if not nil
+	Distribution   *yt.Distribution    // frozen exported distribution, serve merkle proofs if not nil
+	LatePolicy     *yt.LatePolicy      // accept late registrations if not nil
+	RegPolicy      *yt.RegPolicy       // registration window and change policy, unrestricted if nil
+	AdminAPIKey    string              // API key of operators, disabled if empty
+	AdminKeys      []string            // EOS public keys of operators which sign admin requests
+	IPLimit        RateLimit           // rate limit per client IP
+	AccountLimit   RateLimit           // rate limit per account of queries and of registrations with a verified signature
+	ProxyHeader    string              // header set by trusted proxy carrying client IP, e.g. X-Real-IP or X-Forwarded-For
+	TrustedProxies []*net.IPNet        // remote addresses of trusted proxies, ProxyHeader of other clients is ignored
+	BatchLimit     int                 // max accounts of a batch query, DefaultBatchLimit if not positive
+	MaxBodyBytes   int64               // max size of request body, unlimited if not positive
+	MetricsToken   string              // bearer token of /metrics, not served on this handler if empty, see Server.MetricsHandler
+	Now            func() time.Time    // clock, time.Now if nil
+}
+
+//Server registry server
+type Server struct {
+	config         *Config
+	store          Store
+	chain          Chain
+	verifier       Verifier
+	mux            *http.ServeMux
+	nonces         *yt.NonceIssuer
+	ipLimiter      *limiter
+	accountLimiter *limiter
+	metrics        *metrics
+	probe          probe
+}
+
+//NonceResp data of GET /nonce
+type NonceResp struct {
+	*yt.RegMessage
+	TypedData map[string]interface{} `json:"typedData,omitempty"`
+	ESR       string                 `json:"esr,omitempty"`
+}
+
+//New create a registry server
+func New(config *Config, store Store, chain Chain, verifier Verifier) *Server {
+	if config.NonceTTL > yt.MaxRegMessageLifetime {
+		config.NonceTTL = yt.MaxRegMessageLifetime
+	}
+	if config.BatchLimit <= 0 {
+		config.BatchLimit = DefaultBatchLimit
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	s := &Server{config: config, store: store, chain: chain, verifier: verifier, mux: http.NewServeMux(), nonces: yt.NewNonceIssuer(config.NonceKey), ipLimiter: newLimiter(config.IPLimit, config.Now), accountLimiter: newLimiter(config.AccountLimit, config.Now), metrics: newMetrics()}
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	s.mux.HandleFunc("/balance", s.handleBalance)
+	s.mux.HandleFunc("/ethaddr", s.handleEthAddr)
+	s.mux.HandleFunc("/nonce", s.handleNonce)
+	s.mux.HandleFunc("/reg", s.handleReg)
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/batch", s.handleBatch)
+	if config.LatePolicy != nil {
+		s.mux.HandleFunc("/late", s.handleLate)
+	}
+	if config.AdminAPIKey != "" || len(config.AdminKeys) > 0 {
+		s.mux.HandleFunc("/admin/exclude", s.admin(http.MethodPost, s.handleAdminExclude))
+		s.mux.HandleFunc("/admin/ethaddr", s.admin(http.MethodPost, s.handleAdminEthAddr))
+		s.mux.HandleFunc("/admin/refetch", s.admin(http.MethodPost, s.handleAdminRefetch))
+		s.mux.HandleFunc("/admin/payout", s.admin(http.MethodPost, s.handleAdminPayout))
+		s.mux.HandleFunc("/admin/accounts", s.admin(http.MethodGet, s.handleAdminAccounts))
+	}
+	if config.Distribution != nil {
+		s.mux.HandleFunc("/proof", s.handleProof)
+	}
+	if config.MetricsToken != "" {
+		s.mux.HandleFunc("/metrics", s.metricsAuth(s.handleMetrics))
+	}
+	return s
+}
+
+//clientIP IP address of client which sent r, taken from proxy header if configured and r comes from a trusted proxy,
+//the last address of X-Forwarded-For is the one appended by trusted proxy
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if s.config.ProxyHeader != "" && s.trustedProxy(host) {
+		if v := r.Header.Get(s.config.ProxyHeader); v != "" {
+			addrs := strings.Split(v, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	return host
+}
+
+//trustedProxy whether host is in TrustedProxies
+func (s *Server) trustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.config.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseTrustedProxies parse comma separated CIDRs of trusted proxies, a bare IP address stands for itself
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+//unlimited probes only read cached state and are never rate limited
+var unlimited = map[string]bool{"/healthz": true, "/readyz": true}
+
+//ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	_, handler := s.mux.Handler(r)
+	if handler == "" {
+		handler = "none"
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		s.metrics.observeRequest(handler, rec.code, time.Since(start))
+	}()
+	w = rec
+	if !unlimited[handler] {
+		ip := s.clientIP(r)
+		if ok, wait := s.ipLimiter.allow(ip); !ok {
+			writeRateLimited(w, r, wait)
+			fmt.Printf("!!! rate limited: %s on %s\n", ip, r.URL.Path)
+			return
+		}
+	}
+	if s.config.MaxBodyBytes > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+	}
+	s.mux.ServeHTTP(w, r)
+}
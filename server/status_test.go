@@ -0,0 +1,52 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	yt "github.com/aurawing/ytttransfer"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestHandleStatus(t *testing.T) {
+	runCases(t, []apiCase{
+		{name: "missing account and ethaddr", method: "GET", target: "/status", status: 400, code: ErrAccountRequired},
+		{name: "account not found", method: "GET", target: "/status?account=nobody", status: 404, code: ErrAccountNotFound},
+		{name: "internal error of account", method: "GET", target: "/status?account=bob", setup: failStore("GetAccountInfo", errDown), status: 500, code: ErrInternal},
+		{name: "success of account", method: "GET", target: "/status?account=bob", status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if data := resp.Data.(map[string]interface{}); data["account"] != "bob" {
+					t.Fatalf("status is %v", data)
+				}
+			}},
+		{name: "invalid ethaddr", method: "GET", target: "/status?ethaddr=0x1234", status: 400, code: ErrInvalidEthAddr},
+		{name: "internal error of ethaddr", method: "GET", target: "/status?ethaddr=" + testAddrD, setup: failStore("GetAccountsByEthAddr", errDown), status: 500, code: ErrInternal},
+		{name: "success of ethaddr", method: "GET", target: "/status?ethaddr=" + testAddrD, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if data := resp.Data.([]interface{}); len(data) != 2 {
+					t.Fatalf("statuses are %v", data)
+				}
+			}},
+	})
+}
+
+func TestHandleAdminPayout(t *testing.T) {
+	txHash := "0x" + strings.Repeat("ab", common.HashLength)
+	runCases(t, []apiCase{
+		{name: "bad method", method: "GET", target: "/admin/payout", signed: true, status: 405, code: ErrMethodNotAllowed},
+		{name: "bad json", method: "POST", target: "/admin/payout", body: "{", signed: true, status: 400, code: ErrBadRequest},
+		{name: "missing account", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Status: yt.PayoutQueued}, signed: true, status: 400, code: ErrAccountRequired},
+		{name: "unknown status", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "bob", Status: "sent"}, signed: true, status: 400, code: ErrBadRequest},
+		{name: "paid without transaction", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "bob", Status: yt.PayoutPaid, Block: 1}, signed: true, status: 400, code: ErrBadRequest},
+		{name: "paid without block", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "bob", Status: yt.PayoutPaid, TxHash: txHash}, signed: true, status: 400, code: ErrBadRequest},
+		{name: "not found", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "nobody", Status: yt.PayoutQueued}, signed: true, status: 404, code: ErrAccountNotFound},
+		{name: "already paid", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "erin"}, signed: true, status: 409, code: ErrAlreadyPaid},
+		{name: "internal error", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "bob", Status: yt.PayoutQueued}, signed: true, setup: failStore("SetPayout", errDown), status: 500, code: ErrInternal},
+		{name: "success", method: "POST", target: "/admin/payout", body: &AdminPayoutRequest{Account: "dave", Status: yt.PayoutPaid, TxHash: txHash, Block: 7}, signed: true, status: 200,
+			check: func(t *testing.T, f *fixture, resp *Response) {
+				if reg := f.store.regs["dave"]; reg.PayoutStatus != yt.PayoutPaid || reg.PayoutTx != txHash || reg.PayoutBlock != 7 {
+					t.Fatalf("registry is %+v", reg)
+				}
+			}},
+	})
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+//CertReloader serves a TLS certificate loaded from files which can be reloaded without restarting server
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+//NewCertReloader load certificate and key from PEM files
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+//Reload load certificate and key files again, the current certificate is kept if loading fails
+func (reloader *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.mu.Lock()
+	reloader.cert = &cert
+	reloader.mu.Unlock()
+	return nil
+}
+
+//GetCertificate implements tls.Config.GetCertificate
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+	return reloader.cert, nil
+}
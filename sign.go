@@ -0,0 +1,41 @@
+package ytttransfer
+
+import (
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/eoscanada/eos-go/btcsuite/btcd/btcec"
+	"github.com/mr-tron/base58"
+)
+
+//Sign sign sha256(data) by K1 private key in legacy WIF or PVT_K1_ format, returns canonical SIG_K1_ signature
+func Sign(privateKey string, data []byte) (string, error) {
+	secret, err := key.ParsePrivate(privateKey)
+	if err != nil {
+		return "", err
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), secret)
+	sign, err := privKey.SignCanonical(btcec.S256(), sha256Sum(data))
+	if err != nil {
+		return "", err
+	}
+	return "SIG_K1_" + base58.Encode(append(sign, key.Checksum(sign, "K1")...)), nil
+}
+
+//PublicKeyOf canonical public key of K1 private key in legacy WIF or PVT_K1_ format
+func PublicKeyOf(privateKey string) (*key.PublicKey, error) {
+	secret, err := key.ParsePrivate(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), secret)
+	return key.New(key.K1, pubKey.SerializeCompressed())
+}
+
+//SignRegistration sign registration message by K1 private key
+func SignRegistration(privateKey string, msg *RegMessage) (string, error) {
+	return Sign(privateKey, msg.Bytes())
+}
+
+//SignLateRegistration sign late registration message by K1 private key
+func SignLateRegistration(privateKey string, msg *LateRegMessage) (string, error) {
+	return Sign(privateKey, msg.Bytes())
+}
@@ -0,0 +1,93 @@
+package ytttransfer
+
+import (
+	"testing"
+
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/mr-tron/base58"
+)
+
+const (
+	//testWIF well known EOSIO development key
+	testWIF = "5KQwrPbwdL6PhXujxW37FSSQZ1JiwsST4cqQzDeyXtP79zkvFD3"
+	//testWIFPub public key of testWIF
+	testWIFPub = "EOS6MRyAjQq8ud7hVNYcfnVPJqcVpscN5So8BhtHuGYqET5GDW5CV"
+)
+
+func TestPublicKeyOf(t *testing.T) {
+	secret, err := key.ParsePrivate(testWIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvt := "PVT_K1_" + base58.Encode(append(append([]byte{}, secret...), key.Checksum(secret, "K1")...))
+	for _, privateKey := range []string{testWIF, pvt} {
+		pub, err := PublicKeyOf(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.Equal(key.MustParse(testWIFPub)) {
+			t.Fatalf("public key of %s is %s, want %s", privateKey, pub, testWIFPub)
+		}
+	}
+	for _, privateKey := range []string{"", "PVT_R1_abc", testWIF[:len(testWIF)-1] + "4", pvt[:len(pvt)-1]} {
+		if _, err := PublicKeyOf(privateKey); err == nil {
+			t.Fatalf("%q is accepted", privateKey)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	data := []byte("domain=ytttransfer&chainId=00&account=alice")
+	sig, err := Sign(testWIF, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(testWIFPub, data, sig) {
+		t.Fatal("signature is rejected")
+	}
+	canonical := key.MustParse(testWIFPub).String()
+	if !Verify(canonical, data, sig) {
+		t.Fatal("signature is rejected by canonical public key")
+	}
+	recovered, err := RecoverPublicKey(data, sig)
+	if err != nil || recovered.String() != canonical {
+		t.Fatalf("recovered %v, %v", recovered, err)
+	}
+	if Verify(testK1Key, data, sig) {
+		t.Fatal("signature is accepted by another key")
+	}
+	if Verify(testWIFPub, append(data, '!'), sig) {
+		t.Fatal("signature of tampered data is accepted")
+	}
+	again, err := Sign(testWIF, data)
+	if err != nil || again != sig {
+		t.Fatal("signature is not deterministic")
+	}
+}
+
+func TestSignRegistration(t *testing.T) {
+	msg := testRegMessage()
+	sig, err := SignRegistration(testWIF, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyRegistration(testWIFPub, msg, SigTypeRaw, sig) || !VerifyRegistration(testWIFPub, msg, "", sig) {
+		t.Fatal("registration signature is rejected")
+	}
+	if VerifyRegistration(testWIFPub, msg, SigTypeScatter, sig) {
+		t.Fatal("raw signature is accepted as scatter signature")
+	}
+	msg.EthAddr = "0x00000000000000000000000000000000000000a1"
+	if VerifyRegistration(testWIFPub, msg, SigTypeRaw, sig) {
+		t.Fatal("signature of another address is accepted")
+	}
+
+	late := &LateRegMessage{Domain: "ytttransfer", ChainID: "00", Account: "alice", IssuedAt: 1, Expiry: 2}
+	sig, err = SignLateRegistration(testWIF, late)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(testWIFPub, late.Bytes(), sig) {
+		t.Fatal("late registration signature is rejected")
+	}
+}
@@ -0,0 +1,171 @@
+package ytttransfer
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/aurawing/ytttransfer/key"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+//SnapshotEntry one account stored in a snapshot collection
+type SnapshotEntry struct {
+	Account string `bson:"_id" json:"account"`
+	Pubkey  string `bson:"pubkey" json:"pubkey"`
+	Balance int64  `bson:"balance" json:"balance"`
+}
+
+//SnapshotChange an account existing in both snapshots whose balance or public key differs
+type SnapshotChange struct {
+	Account    string `json:"account"`
+	OldPubkey  string `json:"oldPubkey"`
+	NewPubkey  string `json:"newPubkey"`
+	OldBalance int64  `json:"oldBalance"`
+	NewBalance int64  `json:"newBalance"`
+}
+
+//SnapshotDiff differences between two snapshots
+type SnapshotDiff struct {
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Added       []*SnapshotEntry  `json:"added"`
+	Removed     []*SnapshotEntry  `json:"removed"`
+	Changed     []*SnapshotChange `json:"changed"`
+	FromCount   int               `json:"fromCount"`
+	ToCount     int               `json:"toCount"`
+	FromBalance int64             `json:"fromBalance"`
+	ToBalance   int64             `json:"toBalance"`
+}
+
+func snapshotCollection(snapshotID string) string {
+	if snapshotID == "" {
+		return "snapshot"
+	}
+	return "snapshot_" + snapshotID
+}
+
+//GetSnapshot load all entries of snapshot identified by snapshotID
+func (client *Mongoc) GetSnapshot(snapshotID string) (map[string]*SnapshotEntry, error) {
+	collection := client.Client.Database("ytttransfer").Collection(snapshotCollection(snapshotID))
+	cur, err := collection.Find(context.Background(), bson.M{})
+	if err != nil {
+		log.Printf("!!! error when query snapshot: %s -> %s\n", snapshotID, err.Error())
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	entries := make(map[string]*SnapshotEntry)
+	for cur.Next(context.Background()) {
+		entry := new(SnapshotEntry)
+		err := cur.Decode(entry)
+		if err != nil {
+			log.Printf("!!! error when decode snapshot entry: %s -> %s\n", snapshotID, err.Error())
+			return nil, err
+		}
+		entries[entry.Account] = entry
+	}
+	if err := cur.Err(); err != nil {
+		log.Printf("!!! error when iterate snapshot: %s -> %s\n", snapshotID, err.Error())
+		return nil, err
+	}
+	return entries, nil
+}
+
+//DiffSnapshot compare snapshot "from" with snapshot "to"
+func (client *Mongoc) DiffSnapshot(from, to string) (*SnapshotDiff, error) {
+	fromEntries, err := client.GetSnapshot(from)
+	if err != nil {
+		return nil, err
+	}
+	toEntries, err := client.GetSnapshot(to)
+	if err != nil {
+		return nil, err
+	}
+	diff := DiffSnapshotEntries(fromEntries, toEntries)
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
+
+//DiffSnapshotEntries compare two sets of snapshot entries, results are sorted by account name,
+//public keys are compared in canonical form so that legacy keys of older snapshots match PUB_K1_ keys
+func DiffSnapshotEntries(from, to map[string]*SnapshotEntry) *SnapshotDiff {
+	diff := &SnapshotDiff{
+		Added:     make([]*SnapshotEntry, 0),
+		Removed:   make([]*SnapshotEntry, 0),
+		Changed:   make([]*SnapshotChange, 0),
+		FromCount: len(from),
+		ToCount:   len(to),
+	}
+	for account, old := range from {
+		diff.FromBalance += old.Balance
+		cur, ok := to[account]
+		if !ok {
+			diff.Removed = append(diff.Removed, old)
+			continue
+		}
+		if old.Balance != cur.Balance || !samePubkey(old.Pubkey, cur.Pubkey) {
+			diff.Changed = append(diff.Changed, &SnapshotChange{Account: account, OldPubkey: old.Pubkey, NewPubkey: cur.Pubkey, OldBalance: old.Balance, NewBalance: cur.Balance})
+		}
+	}
+	for account, cur := range to {
+		diff.ToBalance += cur.Balance
+		if _, ok := from[account]; !ok {
+			diff.Added = append(diff.Added, cur)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Account < diff.Added[j].Account })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Account < diff.Removed[j].Account })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Account < diff.Changed[j].Account })
+	return diff
+}
+
+//WriteCSV write every difference as one CSV row followed by a summary row with aggregate deltas,
+//account column of summary row is empty and the delta of account count is in its own count_delta column
+func (diff *SnapshotDiff) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	fmtInt := func(i int64) string { return strconv.FormatInt(i, 10) }
+	records := [][]string{{"type", "account", "old_pubkey", "new_pubkey", "old_balance", "new_balance", "delta", "count_delta"}}
+	for _, e := range diff.Added {
+		records = append(records, []string{"added", e.Account, "", e.Pubkey, "0", fmtInt(e.Balance), fmtInt(e.Balance), ""})
+	}
+	for _, e := range diff.Removed {
+		records = append(records, []string{"removed", e.Account, e.Pubkey, "", fmtInt(e.Balance), "0", fmtInt(-e.Balance), ""})
+	}
+	for _, c := range diff.Changed {
+		typ := "balance"
+		if !samePubkey(c.OldPubkey, c.NewPubkey) {
+			if c.OldBalance != c.NewBalance {
+				typ = "balance+key"
+			} else {
+				typ = "key"
+			}
+		}
+		records = append(records, []string{typ, c.Account, c.OldPubkey, c.NewPubkey, fmtInt(c.OldBalance), fmtInt(c.NewBalance), fmtInt(c.NewBalance - c.OldBalance), ""})
+	}
+	records = append(records, []string{"total", "", "", "", fmtInt(diff.FromBalance), fmtInt(diff.ToBalance), fmtInt(diff.ToBalance - diff.FromBalance), strconv.Itoa(diff.ToCount - diff.FromCount)})
+	err := cw.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+//samePubkey compare public keys by canonical form, keys which cannot be parsed are compared as they are
+func samePubkey(a, b string) bool {
+	if a == b {
+		return true
+	}
+	canonicalA, err := key.Canonical(a)
+	if err != nil {
+		return false
+	}
+	canonicalB, err := key.Canonical(b)
+	if err != nil {
+		return false
+	}
+	return canonicalA == canonicalB
+}
@@ -0,0 +1,123 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const (
+	testK1Key = "PUB_K1_79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHWykZkr"
+	testR1Key = "PUB_R1_6C2Ekbu5wWghkwwUinjodCqtrSL5qEdA9vb35MvYxzVwAyXYNR"
+	//testStrippedKey testK1Key in legacy form whose chain prefix is stripped, as stored by older snapshots
+	testStrippedKey = "79Wq9m8V6SQ82HEW5SHJfmKWXqvdMqtKsoMs8SyeZECHZUYw3o"
+)
+
+func snapshotOf(entries ...*SnapshotEntry) map[string]*SnapshotEntry {
+	m := make(map[string]*SnapshotEntry)
+	for _, e := range entries {
+		m[e.Account] = e
+	}
+	return m
+}
+
+func testDiff() *SnapshotDiff {
+	from := snapshotOf(
+		&SnapshotEntry{Account: "alice", Pubkey: testK1Key, Balance: 100},
+		&SnapshotEntry{Account: "bob", Pubkey: testK1Key, Balance: 200},
+		&SnapshotEntry{Account: "carol", Pubkey: testK1Key, Balance: 300},
+		&SnapshotEntry{Account: "dave", Pubkey: testK1Key, Balance: 400},
+		&SnapshotEntry{Account: "erin", Pubkey: testK1Key, Balance: 500},
+	)
+	to := snapshotOf(
+		&SnapshotEntry{Account: "alice", Pubkey: testK1Key, Balance: 100},
+		&SnapshotEntry{Account: "bob", Pubkey: testK1Key, Balance: 250},
+		&SnapshotEntry{Account: "carol", Pubkey: testR1Key, Balance: 300},
+		&SnapshotEntry{Account: "dave", Pubkey: testR1Key, Balance: 350},
+		&SnapshotEntry{Account: "frank", Pubkey: testK1Key, Balance: 600},
+		&SnapshotEntry{Account: "gina", Pubkey: testK1Key, Balance: 700},
+	)
+	return DiffSnapshotEntries(from, to)
+}
+
+func TestDiffSnapshotEntries(t *testing.T) {
+	diff := testDiff()
+	accounts := func(entries []*SnapshotEntry) []string {
+		names := make([]string, 0)
+		for _, e := range entries {
+			names = append(names, e.Account)
+		}
+		return names
+	}
+	if got := accounts(diff.Added); !reflect.DeepEqual(got, []string{"frank", "gina"}) {
+		t.Errorf("added %v", got)
+	}
+	if got := accounts(diff.Removed); !reflect.DeepEqual(got, []string{"erin"}) {
+		t.Errorf("removed %v", got)
+	}
+	want := []*SnapshotChange{
+		{Account: "bob", OldPubkey: testK1Key, NewPubkey: testK1Key, OldBalance: 200, NewBalance: 250},
+		{Account: "carol", OldPubkey: testK1Key, NewPubkey: testR1Key, OldBalance: 300, NewBalance: 300},
+		{Account: "dave", OldPubkey: testK1Key, NewPubkey: testR1Key, OldBalance: 400, NewBalance: 350},
+	}
+	if !reflect.DeepEqual(diff.Changed, want) {
+		t.Errorf("changed %+v", diff.Changed)
+	}
+	if diff.FromCount != 5 || diff.ToCount != 6 || diff.FromBalance != 1500 || diff.ToBalance != 2300 {
+		t.Errorf("totals %d %d %d %d", diff.FromCount, diff.ToCount, diff.FromBalance, diff.ToBalance)
+	}
+}
+
+func TestDiffSnapshotEntriesEmpty(t *testing.T) {
+	diff := DiffSnapshotEntries(map[string]*SnapshotEntry{}, map[string]*SnapshotEntry{})
+	if diff.Added == nil || diff.Removed == nil || diff.Changed == nil {
+		t.Fatal("empty differences must be encoded as empty lists")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := testDiff().WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "type,account,old_pubkey,new_pubkey,old_balance,new_balance,delta,count_delta\n" +
+		"added,frank,," + testK1Key + ",0,600,600,\n" +
+		"added,gina,," + testK1Key + ",0,700,700,\n" +
+		"removed,erin," + testK1Key + ",,500,0,-500,\n" +
+		"balance,bob," + testK1Key + "," + testK1Key + ",200,250,50,\n" +
+		"key,carol," + testK1Key + "," + testR1Key + ",300,300,0,\n" +
+		"balance+key,dave," + testK1Key + "," + testR1Key + ",400,350,-50,\n" +
+		"total,,,,1500,2300,800,1\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestDiffSnapshotEntriesLegacyKeys(t *testing.T) {
+	from := snapshotOf(
+		&SnapshotEntry{Account: "alice", Pubkey: testStrippedKey, Balance: 100},
+		&SnapshotEntry{Account: "bob", Pubkey: testStrippedKey, Balance: 200},
+		&SnapshotEntry{Account: "carol", Pubkey: testStrippedKey, Balance: 300},
+		&SnapshotEntry{Account: "dave", Pubkey: "garbage", Balance: 400},
+		&SnapshotEntry{Account: "erin", Pubkey: "", Balance: 500},
+	)
+	to := snapshotOf(
+		&SnapshotEntry{Account: "alice", Pubkey: testK1Key, Balance: 100},
+		&SnapshotEntry{Account: "bob", Pubkey: "YTA" + testStrippedKey, Balance: 250},
+		&SnapshotEntry{Account: "carol", Pubkey: testR1Key, Balance: 300},
+		&SnapshotEntry{Account: "dave", Pubkey: "garbage", Balance: 400},
+		&SnapshotEntry{Account: "erin", Pubkey: testK1Key, Balance: 500},
+	)
+	buf := new(bytes.Buffer)
+	if err := DiffSnapshotEntries(from, to).WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "type,account,old_pubkey,new_pubkey,old_balance,new_balance,delta,count_delta\n" +
+		"balance,bob," + testStrippedKey + ",YTA" + testStrippedKey + ",200,250,50,\n" +
+		"key,carol," + testStrippedKey + "," + testR1Key + ",300,300,0,\n" +
+		"key,erin,," + testK1Key + ",500,500,0,\n" +
+		"total,,,,1500,1550,50,0\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,151 @@
+package ytttransfer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+//AccountStatus lifecycle status of an account from snapshot to payout
+type AccountStatus struct {
+	Account       string `json:"account"`
+	Balance       int64  `json:"balance"`
+	BalanceText   string `json:"balanceText"`
+	Precision     int    `json:"precision"`
+	Late          bool   `json:"late"`
+	Registered    bool   `json:"registered"`
+	RegisteredAt  int64  `json:"registeredAt,omitempty"`
+	EthAddr       string `json:"ethaddr,omitempty"`
+	EthVerified   bool   `json:"ethVerified"`
+	Changes       int    `json:"changes"`
+	Excluded      bool   `json:"excluded"`
+	ExcludeReason string `json:"excludeReason,omitempty"`
+	PayoutStatus  string `json:"payoutStatus,omitempty"`
+	PayoutTx      string `json:"payoutTx,omitempty"`
+	PayoutBlock   uint64 `json:"payoutBlock,omitempty"`
+}
+
+//NewAccountStatus build status of account from its registry entry
+func NewAccountStatus(reg *Registry) *AccountStatus {
+	return &AccountStatus{
+		Account:       reg.Account,
+		Balance:       reg.Balance,
+		BalanceText:   FormatYTT(reg.Balance),
+		Precision:     YTTPrecision,
+		Late:          reg.Late,
+		Registered:    reg.EthAddr != "",
+		RegisteredAt:  reg.RegisteredAt,
+		EthAddr:       reg.EthAddr,
+		EthVerified:   reg.EthVerified,
+		Changes:       reg.Changes,
+		Excluded:      reg.Exclude,
+		ExcludeReason: reg.ExcludeReason,
+		PayoutStatus:  reg.PayoutStatus,
+		PayoutTx:      reg.PayoutTx,
+		PayoutBlock:   reg.PayoutBlock,
+	}
+}
+
+//FormatYTT format balance in smallest unit as decimal YTT amount, e.g. 12345 -> "1.2345 YTT"
+func FormatYTT(balance int64) string {
+	sign := ""
+	if balance < 0 {
+		sign = "-"
+		balance = -balance
+	}
+	unit := int64(1)
+	for i := 0; i < YTTPrecision; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d YTT", sign, balance/unit, YTTPrecision, balance%unit)
+}
+
+//GetAccountsByEthAddr list registry entries bound to ethaddr, addresses registered before checksum validation are matched too
+func (client *Mongoc) GetAccountsByEthAddr(ethaddr common.Address) ([]*Registry, error) {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	hex := ethaddr.Hex()
+	variants := bson.A{hex, strings.ToLower(hex), "0x" + strings.ToUpper(hex[2:])}
+	cur, err := collection.Find(context.Background(), bson.M{"ethaddr": bson.M{"$in": variants}})
+	if err != nil {
+		log.Printf("!!! error when query accounts of ethaddr: %s -> %s\n", hex, err.Error())
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	regs := make([]*Registry, 0)
+	for cur.Next(context.Background()) {
+		reg := new(Registry)
+		err := cur.Decode(reg)
+		if err != nil {
+			log.Printf("!!! error when decode registry: %s\n", err.Error())
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, cur.Err()
+}
+
+//GetAccountInfos get registry entries of accounts by a single query, accounts not in registry are omitted
+func (client *Mongoc) GetAccountInfos(accounts []string) ([]*Registry, error) {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	cur, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": accounts}})
+	if err != nil {
+		log.Printf("!!! error when query accounts: %s\n", err.Error())
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	regs := make([]*Registry, 0, len(accounts))
+	for cur.Next(context.Background()) {
+		reg := new(Registry)
+		err := cur.Decode(reg)
+		if err != nil {
+			log.Printf("!!! error when decode registry: %s\n", err.Error())
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, cur.Err()
+}
+
+//RegistryCounts number of accounts in snapshot and in each status of registry, progress of snapshot and payout
+type RegistryCounts struct {
+	Snapshot     int64
+	Total        int64
+	Registered   int64
+	Unregistered int64
+	Excluded     int64
+	Late         int64
+	Queued       int64
+	Paid         int64
+}
+
+//Counts count accounts in default snapshot and in each status of registry
+func (client *Mongoc) Counts() (*RegistryCounts, error) {
+	db := client.Client.Database("ytttransfer")
+	counts := new(RegistryCounts)
+	var err error
+	counts.Snapshot, err = db.Collection(snapshotCollection("")).CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for status, n := range map[string]*int64{StatusAll: &counts.Total, StatusRegistered: &counts.Registered, StatusUnregistered: &counts.Unregistered, StatusExcluded: &counts.Excluded, StatusLate: &counts.Late, StatusQueued: &counts.Queued, StatusPaid: &counts.Paid} {
+		filter, _ := statusFilter(status)
+		*n, err = db.Collection("registry").CountDocuments(context.Background(), filter)
+		if err != nil {
+			log.Printf("!!! error when count accounts of status %q: %s\n", status, err.Error())
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+//Ping check MongoDB is reachable
+func (client *Mongoc) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return client.Client.Ping(ctx, nil)
+}
@@ -0,0 +1,28 @@
+package ytttransfer
+
+import "testing"
+
+func TestFormatYTT(t *testing.T) {
+	for balance, want := range map[int64]string{
+		0:      "0.0000 YTT",
+		1:      "0.0001 YTT",
+		12345:  "1.2345 YTT",
+		100000: "10.0000 YTT",
+		-12345: "-1.2345 YTT",
+	} {
+		if got := FormatYTT(balance); got != want {
+			t.Fatalf("%d is formatted as %q, want %q", balance, got, want)
+		}
+	}
+}
+
+func TestNewAccountStatus(t *testing.T) {
+	s := NewAccountStatus(&Registry{Account: "alice", Balance: 12345, Exclude: true, ExcludeReason: "test"})
+	if s.Registered || !s.Excluded || s.ExcludeReason != "test" || s.BalanceText != "1.2345 YTT" || s.Precision != YTTPrecision {
+		t.Fatalf("status is %+v", s)
+	}
+	s = NewAccountStatus(&Registry{Account: "bob", EthAddr: testEthAddr, RegisteredAt: 7, Changes: 1, PayoutStatus: PayoutPaid, PayoutTx: "0xab", PayoutBlock: 9})
+	if !s.Registered || s.EthAddr != testEthAddr || s.RegisteredAt != 7 || s.Changes != 1 || s.PayoutStatus != PayoutPaid || s.PayoutTx != "0xab" || s.PayoutBlock != 9 {
+		t.Fatalf("status is %+v", s)
+	}
+}
@@ -78,6 +78,11 @@ func (s *TokenTransaction) Transaction(toAddress, privatekey string, tokenAmount
 	auth.GasLimit = uint64(200000) // in units
 	auth.GasPrice = gasPrice
 
+	to, err := ValidateEthAddr(toAddress)
+	if err != nil {
+		return
+	}
+
 	token, err := NewToken(common.HexToAddress(s.contractAddress), s.client)
 	if err != nil {
 		return
@@ -87,7 +92,7 @@ func (s *TokenTransaction) Transaction(toAddress, privatekey string, tokenAmount
 	tenDecimal := big.NewFloat(math.Pow(10, float64(18)))
 	convertAmount, _ := new(big.Float).Mul(tenDecimal, amount).Int(&big.Int{})
 	auth.GasLimit = 20000000
-	txs, err := token.Transfer(auth, common.HexToAddress(toAddress), convertAmount)
+	txs, err := token.Transfer(auth, to, convertAmount)
 	if err != nil {
 		return
 	}
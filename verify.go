@@ -2,53 +2,144 @@ package ytttransfer
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"errors"
+	"math/big"
 	"strings"
 
+	"github.com/aurawing/ytttransfer/key"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	ecrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/mr-tron/base58"
-	"golang.org/x/crypto/ripemd160"
 )
 
-//Verify verify signature for data by public key
+var (
+	//ErrSigBadPrefix signature prefix is neither SIG_K1_ nor SIG_R1_
+	ErrSigBadPrefix = errors.New("signature prefix must be SIG_K1_ or SIG_R1_")
+	//ErrSigBadEncoding signature is not valid base58
+	ErrSigBadEncoding = errors.New("signature is not valid base58")
+	//ErrSigBadLength decoded signature is not 65 bytes plus 4 bytes checksum
+	ErrSigBadLength = errors.New("invalid signature length")
+	//ErrSigBadChecksum checksum of signature mismatch
+	ErrSigBadChecksum = errors.New("signature checksum mismatch")
+	//ErrSigBadRecoveryID recovery byte of signature is out of range
+	ErrSigBadRecoveryID = errors.New("invalid signature recovery id")
+	//ErrSigNonCanonical signature is not canonical or has high S value
+	ErrSigNonCanonical = errors.New("signature is not canonical")
+)
+
+//Verify verify signature for data by public key, SIG_K1_ and SIG_R1_ signatures are supported
 func Verify(publicKey string, data []byte, signature string) bool {
-	if !strings.HasPrefix(signature, "SIG_K1_") {
+	expected, err := key.Parse(publicKey)
+	if err != nil {
 		return false
 	}
-	signature = strings.TrimPrefix(signature, "SIG_K1_")
-	sigbytes, _ := base58.Decode(signature)
-	sign := sigbytes[0:65]
-	checksum := sigbytes[65:]
-	sign1 := append([]byte{}, sign...)
-	ck := ripemd160Sum(append(sign1, 'K', '1'))
-	if !bytes.Equal(checksum, ck[0:4]) {
+	recovered, err := RecoverPublicKey(data, signature)
+	if err != nil {
 		return false
 	}
-	sign[0] -= 4
-	sign[0] -= 27
-	signx := append(sign[1:65], sign[0])
-	recPubkey, err := ecrypto.Ecrecover(sha256Sum(data), signx)
+	return recovered.Equal(expected)
+}
+
+//RecoverPublicKey recover public key from signature of sha256(data)
+func RecoverPublicKey(data []byte, signature string) (*key.PublicKey, error) {
+	var curve key.Curve
+	switch {
+	case strings.HasPrefix(signature, "SIG_K1_"):
+		curve = key.K1
+	case strings.HasPrefix(signature, "SIG_R1_"):
+		curve = key.R1
+	default:
+		return nil, ErrSigBadPrefix
+	}
+	sigbytes, err := base58.Decode(signature[len("SIG_K1_"):])
+	if err != nil || len(sigbytes) == 0 {
+		return nil, ErrSigBadEncoding
+	}
+	if len(sigbytes) != 69 {
+		return nil, ErrSigBadLength
+	}
+	sign := append([]byte{}, sigbytes[0:65]...)
+	if !bytes.Equal(sigbytes[65:], key.Checksum(sign, curve.String())) {
+		return nil, ErrSigBadChecksum
+	}
+	return recoverDigest(curve, sha256Sum(data), sign)
+}
+
+//recoverDigest recover public key from 65 bytes compact signature of a 32 bytes digest
+func recoverDigest(curve key.Curve, hash []byte, sign []byte) (*key.PublicKey, error) {
+	if len(sign) != 65 {
+		return nil, ErrSigBadLength
+	}
+	// recovery byte is 27 + 4 (compressed) + recovery id
+	if sign[0] < 27+4 || sign[0] > 27+4+3 {
+		return nil, ErrSigBadRecoveryID
+	}
+	recid := sign[0] - 27 - 4
+	if !isLowS(curve, sign[33:65]) {
+		return nil, ErrSigNonCanonical
+	}
+	if curve == key.R1 {
+		recPublicKey, err := recoverP256(hash, append([]byte{recid}, sign[1:65]...))
+		if err != nil {
+			return nil, err
+		}
+		return key.New(key.R1, compressP256(recPublicKey))
+	}
+	if !isCanonical(sign) {
+		return nil, ErrSigNonCanonical
+	}
+	recPubkey, err := ecrypto.Ecrecover(hash, append(append([]byte{}, sign[1:65]...), recid))
 	if err != nil {
-		return false
+		return nil, err
 	}
 	recPublicKey, err := ecrypto.UnmarshalPubkey(recPubkey)
 	if err != nil {
+		return nil, err
+	}
+	return key.New(key.K1, ecrypto.CompressPubkey(recPublicKey))
+}
+
+//isLowS s must not be greater than half of the curve order, otherwise the signature is malleable
+func isLowS(curve key.Curve, s []byte) bool {
+	n := ecrypto.S256().Params().N
+	if curve == key.R1 {
+		n = elliptic.P256().Params().N
+	}
+	halfN := new(big.Int).Rsh(n, 1)
+	return new(big.Int).SetBytes(s).Cmp(halfN) <= 0
+}
+
+//isCanonical canonical check of K1 signature done by EOSIO, both r and s must be 32 bytes long without sign bit
+func isCanonical(sign []byte) bool {
+	return sign[1]&0x80 == 0 && !(sign[1] == 0 && sign[2]&0x80 == 0) &&
+		sign[33]&0x80 == 0 && !(sign[33] == 0 && sign[34]&0x80 == 0)
+}
+
+//VerifyEth verify EIP-191 personal_sign signature for data by Ethereum address
+func VerifyEth(ethaddr string, data []byte, signature string) bool {
+	return verifyEthHash(ethaddr, accounts.TextHash(data), signature)
+}
+
+func verifyEthHash(ethaddr string, hash []byte, signature string) bool {
+	if !common.IsHexAddress(ethaddr) {
 		return false
 	}
-	recPublicKeyBytes := ecrypto.CompressPubkey(recPublicKey)
-	checksum = ripemd160Sum(recPublicKeyBytes)
-	rawRecPublicKeyBytes := append(recPublicKeyBytes, checksum[0:4]...)
-	rawPublicKeyBytes, err := base58.Decode(publicKey)
-	if err != nil {
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != 65 {
 		return false
 	}
-	if len(rawPublicKeyBytes) == 33 {
-		return bytes.Equal(rawPublicKeyBytes, rawRecPublicKeyBytes[0:33])
-	} else if len(rawPublicKeyBytes) == 37 {
-		return bytes.Equal(rawPublicKeyBytes, rawRecPublicKeyBytes[0:37])
-	} else {
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	recPublicKey, err := ecrypto.SigToPub(hash, sig)
+	if err != nil {
 		return false
 	}
+	return ecrypto.PubkeyToAddress(*recPublicKey) == common.HexToAddress(ethaddr)
 }
 
 func sha256Sum(bytes []byte) []byte {
@@ -56,9 +147,3 @@ func sha256Sum(bytes []byte) []byte {
 	h.Write(bytes)
 	return h.Sum(nil)
 }
-
-func ripemd160Sum(bytes []byte) []byte {
-	h := ripemd160.New()
-	h.Write(bytes)
-	return h.Sum(nil)
-}
@@ -0,0 +1,151 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aurawing/ytttransfer/key"
+)
+
+//corpus directory of seed inputs "<public key>\n<signature>\n<data>"
+const corpus = "testdata/fuzz/corpus"
+
+func readCorpus(t testing.TB, name string) []byte {
+	input, err := ioutil.ReadFile(filepath.Join(corpus, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+//checkVerify verify input and check that public keys round trip and Verify agrees with key recovery,
+//returns whether signature is accepted
+func checkVerify(t *testing.T, input []byte) bool {
+	parts := bytes.SplitN(input, []byte{'\n'}, 3)
+	if len(parts) != 3 {
+		return false
+	}
+	publicKey, signature, data := string(parts[0]), string(parts[1]), parts[2]
+
+	expected, err := key.Parse(publicKey)
+	if err == nil {
+		again, err := key.Parse(expected.String())
+		if err != nil || !again.Equal(expected) {
+			t.Fatalf("canonical public key %s does not round trip", expected)
+		}
+		if expected.Curve == key.K1 {
+			legacy, err := expected.Legacy("YTA")
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err = key.Parse(legacy)
+			if err != nil || !again.Equal(expected) {
+				t.Fatalf("legacy public key %s does not round trip", legacy)
+			}
+		}
+	}
+
+	recovered, recErr := RecoverPublicKey(data, signature)
+	if recErr == nil {
+		again, err := key.Parse(recovered.String())
+		if err != nil || !again.Equal(recovered) {
+			t.Fatalf("recovered public key %s does not round trip", recovered)
+		}
+	}
+
+	ok := Verify(publicKey, data, signature)
+	if ok && (recErr != nil || expected == nil || !recovered.Equal(expected)) {
+		t.Fatal("Verify accepted a signature not matching the public key")
+	}
+	if !ok && recErr == nil && expected != nil && recovered.Equal(expected) {
+		t.Fatal("Verify rejected a signature matching the public key")
+	}
+	return ok
+}
+
+func TestVerifyCorpus(t *testing.T) {
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{"k1-valid", true},
+		{"r1-valid", true},
+		{"k1-canonical-key", true},
+		{"empty", false},
+		{"garbage", false},
+		{"k1-bad-checksum", false},
+		{"k1-short-sig", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if ok := checkVerify(t, readCorpus(t, c.name)); ok != c.ok {
+				t.Fatalf("Verify = %v, want %v", ok, c.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedData(t *testing.T) {
+	for _, name := range []string{"k1-valid", "r1-valid"} {
+		input := readCorpus(t, name)
+		input[len(input)-1]++
+		if checkVerify(t, input) {
+			t.Fatalf("%s: Verify accepted tampered data", name)
+		}
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	files, err := ioutil.ReadDir(corpus)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		f.Add(readCorpus(f, file.Name()))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		checkVerify(t, input)
+	})
+}
+
+const (
+	//testEthAddr address of well known private key 0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80
+	testEthAddr = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	//testEthSig personal_sign of testRegMessage by testEthAddr
+	testEthSig = "0xbbbdcccc09602a75eab6449f38525cf1fb67246053557e3b4a6e0884f0906549395037f9c2632cf303a0d92e24f4b4497e660e568eb8c85a0c94e39564b72c731c"
+)
+
+func testRegMessage() *RegMessage {
+	return &RegMessage{Domain: "ytttransfer", ChainID: "00", Account: "alice", EthAddr: testEthAddr, Nonce: "00", IssuedAt: 1, Expiry: 2}
+}
+
+func TestVerifyEth(t *testing.T) {
+	data := testRegMessage().Bytes()
+	rawV := testEthSig[:len(testEthSig)-2] + "01" // v as 0/1 instead of 27/28
+	cases := []struct {
+		name      string
+		ethaddr   string
+		data      []byte
+		signature string
+		ok        bool
+	}{
+		{"valid", testEthAddr, data, testEthSig, true},
+		{"lower case address", strings.ToLower(testEthAddr), data, testEthSig, true},
+		{"v without offset", testEthAddr, data, rawV, true},
+		{"another address", "0x00000000000000000000000000000000000000a1", data, testEthSig, false},
+		{"tampered data", testEthAddr, append(append([]byte{}, data...), '0'), testEthSig, false},
+		{"invalid address", "0x1234", data, testEthSig, false},
+		{"short signature", testEthAddr, data, testEthSig[:len(testEthSig)-2], false},
+		{"not hex", testEthAddr, data, "0xzz" + testEthSig[4:], false},
+		{"no prefix", testEthAddr, data, testEthSig[2:], false},
+		{"empty", testEthAddr, data, "", false},
+	}
+	for _, c := range cases {
+		if ok := VerifyEth(c.ethaddr, c.data, c.signature); ok != c.ok {
+			t.Errorf("%s: VerifyEth = %v, want %v", c.name, ok, c.ok)
+		}
+	}
+}
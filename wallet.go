@@ -0,0 +1,183 @@
+package ytttransfer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aurawing/ytttransfer/eostx"
+)
+
+const (
+	//SigTypeRaw signature of sha256(RegMessage.Bytes()), the default
+	SigTypeRaw = "raw"
+	//SigTypeScatter signature made by Scatter getArbitrarySignature over RegMessage.ScatterBytes()
+	SigTypeScatter = "scatter"
+	//SigTypeESR signature made by a wallet such as Anchor over the transaction of RegMessage.SigningRequest(),
+	//the transaction is not broadcast and its action data carries account, ERC20 address and nonce
+	SigTypeESR = "esr"
+)
+
+//ESRAction name of the action in registration transaction, its contract is the domain of registration message
+const ESRAction = "regethaddr"
+
+//scatterMaxWordLength Scatter refuses to sign arbitrary data containing longer words
+const scatterMaxWordLength = 12
+
+var (
+	//ErrUnknownSigType signing convention is not raw, scatter or esr
+	ErrUnknownSigType = errors.New("unknown signature type")
+	//ErrBadESRMessage registration message can not be carried by an EOSIO transaction
+	ErrBadESRMessage = errors.New("registration message can not be carried by an EOSIO transaction")
+)
+
+//ScatterBytes registration message split into words acceptable by Scatter getArbitrarySignature
+func (msg *RegMessage) ScatterBytes() []byte {
+	fields := []string{msg.Domain, msg.ChainID, msg.Account, msg.EthAddr, msg.Nonce, strconv.FormatInt(msg.IssuedAt, 10), strconv.FormatInt(msg.Expiry, 10)}
+	words := make([]string, 0)
+	for _, field := range fields {
+		for _, f := range strings.Fields(field) {
+			for len(f) > scatterMaxWordLength {
+				words = append(words, f[0:scatterMaxWordLength])
+				f = f[scatterMaxWordLength:]
+			}
+			words = append(words, f)
+		}
+	}
+	return []byte(strings.Join(words, " "))
+}
+
+//ESRTransaction serialized transaction signed for an ESR registration, it expires with the message and has no TAPoS,
+//its only action <domain>::regethaddr authorized by <account>@active carries {account, ethaddr, nonce, issued_at, expiry}
+func (msg *RegMessage) ESRTransaction() ([]byte, error) {
+	contract, err := eosName(msg.Domain)
+	if err != nil {
+		return nil, err
+	}
+	account, err := eosName(msg.Account)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Expiry <= 0 || msg.Expiry > math.MaxUint32 {
+		return nil, ErrBadESRMessage
+	}
+	action, _ := eostx.StringToName(ESRAction)
+	active, _ := eostx.StringToName("active")
+
+	// regethaddr {account: name, ethaddr: string, nonce: string, issued_at: int64, expiry: int64}
+	data := new(bytes.Buffer)
+	binary.Write(data, binary.LittleEndian, account)
+	writeESRString(data, msg.EthAddr)
+	writeESRString(data, msg.Nonce)
+	binary.Write(data, binary.LittleEndian, msg.IssuedAt)
+	binary.Write(data, binary.LittleEndian, msg.Expiry)
+
+	tx := new(bytes.Buffer)
+	binary.Write(tx, binary.LittleEndian, uint32(msg.Expiry))
+	binary.Write(tx, binary.LittleEndian, uint16(0)) // ref_block_num
+	binary.Write(tx, binary.LittleEndian, uint32(0)) // ref_block_prefix
+	tx.WriteByte(0)                                  // max_net_usage_words
+	tx.WriteByte(0)                                  // max_cpu_usage_ms
+	tx.WriteByte(0)                                  // delay_sec
+	tx.WriteByte(0)                                  // context_free_actions
+	tx.WriteByte(1)                                  // actions
+	binary.Write(tx, binary.LittleEndian, contract)
+	binary.Write(tx, binary.LittleEndian, action)
+	tx.WriteByte(1) // authorization
+	binary.Write(tx, binary.LittleEndian, account)
+	binary.Write(tx, binary.LittleEndian, active)
+	writeVarUint32(tx, uint32(data.Len()))
+	tx.Write(data.Bytes())
+	tx.WriteByte(0) // transaction_extensions
+	return tx.Bytes(), nil
+}
+
+//ESRSigningData chain id + ESRTransaction() + zero context free data hash, its sha256 is the digest signed by the wallet
+func (msg *RegMessage) ESRSigningData() ([]byte, error) {
+	chainID, err := hex.DecodeString(msg.ChainID)
+	if err != nil || len(chainID) != 32 {
+		return nil, ErrBadESRMessage
+	}
+	tx, err := msg.ESRTransaction()
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	buf.Write(chainID)
+	buf.Write(tx)
+	buf.Write(make([]byte, 32))
+	return buf.Bytes(), nil
+}
+
+//SigningRequest EOSIO Signing Request (protocol version 2) URI asking the wallet to sign ESRTransaction() without broadcasting it
+func (msg *RegMessage) SigningRequest() (string, error) {
+	chainID, err := hex.DecodeString(msg.ChainID)
+	if err != nil || len(chainID) != 32 {
+		return "", ErrBadESRMessage
+	}
+	tx, err := msg.ESRTransaction()
+	if err != nil {
+		return "", err
+	}
+	req := new(bytes.Buffer)
+	req.WriteByte(2) // version 2, not compressed
+	req.WriteByte(1) // chain_id variant
+	req.Write(chainID)
+	req.WriteByte(2) // transaction variant
+	req.Write(tx)
+	req.WriteByte(0) // flags, no broadcast
+	req.WriteByte(0) // callback
+	req.WriteByte(0) // info
+	return "esr:" + base64.RawURLEncoding.EncodeToString(req.Bytes()), nil
+}
+
+//SignedBytes data whose sha256 is signed under signing convention sigType
+func (msg *RegMessage) SignedBytes(sigType string) ([]byte, error) {
+	switch sigType {
+	case "", SigTypeRaw:
+		return msg.Bytes(), nil
+	case SigTypeScatter:
+		return msg.ScatterBytes(), nil
+	case SigTypeESR:
+		return msg.ESRSigningData()
+	default:
+		return nil, ErrUnknownSigType
+	}
+}
+
+//VerifyRegistration verify EOS signature of registration message by public key according to signing convention sigType
+func VerifyRegistration(publicKey string, msg *RegMessage, sigType, signature string) bool {
+	data, err := msg.SignedBytes(sigType)
+	if err != nil {
+		return false
+	}
+	return Verify(publicKey, data, signature)
+}
+
+//eosName encode s as EOSIO name, s must survive a round trip
+func eosName(s string) (uint64, error) {
+	val, err := eostx.StringToName(s)
+	if err != nil || s == "" || eostx.NameToString(val) != s {
+		return 0, fmt.Errorf("invalid EOSIO name: %q", s)
+	}
+	return val, nil
+}
+
+func writeVarUint32(buf *bytes.Buffer, n uint32) {
+	for n >= 0x80 {
+		buf.WriteByte(byte(n) | 0x80)
+		n >>= 7
+	}
+	buf.WriteByte(byte(n))
+}
+
+func writeESRString(buf *bytes.Buffer, s string) {
+	writeVarUint32(buf, uint32(len(s)))
+	buf.WriteString(s)
+}
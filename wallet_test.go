@@ -0,0 +1,116 @@
+package ytttransfer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const (
+	//testMainnetChainID chain id of EOS mainnet
+	testMainnetChainID = "aca376f206b8fc25a6ed44dbdc66547c36c6c33e3a119ffbeaef943642f0e906"
+	//testESRTransaction ESR transaction of testESRMessage(), serialized independently
+	testESRTransaction = "02000000000000000000000000000100ae5a789a9b73f600c04dc9b4ac98ba010000000000855c3400000000a8ed3232460000000000855c342a3078663339466436653531616164383846364634636536614238383237323739636666466239323236360230300100000000000000020000000000000000"
+	//testESRDigest sha256(chain id + testESRTransaction + 32 zero bytes)
+	testESRDigest = "903be64275f9f73719f2aeae429d9a9b79ed4306d8f31b03da2722e41c21cc36"
+)
+
+//testESRMessage testRegMessage() on EOS mainnet
+func testESRMessage() *RegMessage {
+	msg := testRegMessage()
+	msg.ChainID = testMainnetChainID
+	return msg
+}
+
+func TestScatterBytes(t *testing.T) {
+	want := "ytttransfer 00 alice 0xf39Fd6e51a ad88F6F4ce6a B8827279cffF b92266 00 1 2"
+	if got := string(testRegMessage().ScatterBytes()); got != want {
+		t.Fatalf("scatter bytes are %q, want %q", got, want)
+	}
+	for _, word := range strings.Fields(want) {
+		if len(word) > scatterMaxWordLength {
+			t.Fatalf("word %q is too long", word)
+		}
+	}
+}
+
+func TestESRTransaction(t *testing.T) {
+	msg := testESRMessage()
+	tx, err := msg.ESRTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(tx) != testESRTransaction {
+		t.Fatalf("transaction is %x, want %s", tx, testESRTransaction)
+	}
+	data, err := msg.SignedBytes(SigTypeESR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) != testESRDigest {
+		t.Fatalf("signing digest is %x, want %s", digest, testESRDigest)
+	}
+
+	uri, err := msg.SigningRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(uri, "esr:"))
+	if err != nil || !strings.HasPrefix(uri, "esr:") {
+		t.Fatalf("bad signing request %s", uri)
+	}
+	want := "0201" + testMainnetChainID + "02" + testESRTransaction + "000000"
+	if hex.EncodeToString(req) != want {
+		t.Fatalf("signing request is %x, want %s", req, want)
+	}
+
+	for _, modify := range []func(*RegMessage){
+		func(m *RegMessage) { m.Domain = "ytt-transfer" },
+		func(m *RegMessage) { m.Account = "Alice" },
+		func(m *RegMessage) { m.Account = "" },
+		func(m *RegMessage) { m.Expiry = 0 },
+		func(m *RegMessage) { m.Expiry = 1 << 32 },
+		func(m *RegMessage) { m.ChainID = "00" },
+	} {
+		bad := testESRMessage()
+		modify(bad)
+		if _, err := bad.SignedBytes(SigTypeESR); err == nil {
+			t.Fatalf("%+v is carried by a transaction", bad)
+		}
+	}
+	if _, err := msg.SignedBytes("other"); err != ErrUnknownSigType {
+		t.Fatalf("unknown signature type error is %v", err)
+	}
+}
+
+func TestVerifyRegistrationESR(t *testing.T) {
+	msg := testESRMessage()
+	data, err := msg.SignedBytes(SigTypeESR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(testWIF, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyRegistration(testWIFPub, msg, SigTypeESR, sig) {
+		t.Fatal("esr signature is rejected")
+	}
+	if VerifyRegistration(testWIFPub, msg, SigTypeRaw, sig) || VerifyRegistration(testWIFPub, msg, SigTypeScatter, sig) {
+		t.Fatal("esr signature is accepted as another signature type")
+	}
+	for _, modify := range []func(*RegMessage){
+		func(m *RegMessage) { m.EthAddr = "0x00000000000000000000000000000000000000a1" },
+		func(m *RegMessage) { m.Nonce = "01" },
+		func(m *RegMessage) { m.Account = "bob" },
+		func(m *RegMessage) { m.Expiry++ },
+	} {
+		other := testESRMessage()
+		modify(other)
+		if VerifyRegistration(testWIFPub, other, SigTypeESR, sig) {
+			t.Fatalf("esr signature is accepted for %+v", other)
+		}
+	}
+}
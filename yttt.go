@@ -4,23 +4,48 @@ import (
 	"context"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aurawing/ytttransfer/eostx"
+	"github.com/aurawing/ytttransfer/key"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Registry struct {
-	Account string `json:"_id"`
-	Pubkey  string `json:"pubkey"`
-	Balance int64  `json:"balance"`
-	EthAddr string `json:"ethaddr"`
-	Exclude bool   `json:"exclude"`
+	Account       string          `json:"_id" bson:"_id"`
+	Pubkey        string          `json:"pubkey"`
+	Balance       int64           `json:"balance"`
+	EthAddr       string          `json:"ethaddr"`
+	Exclude       bool            `json:"exclude"`
+	ExcludeReason string          `json:"excludereason,omitempty"`
+	EthVerified   bool            `json:"ethverified"`
+	EthContract   bool            `json:"ethcontract"`
+	KeyDecision   *KeyDecision    `json:"keydecision,omitempty"`
+	Late          bool            `json:"late"`
+	AddedAt       int64           `json:"addedat,omitempty"`
+	RegisteredAt  int64           `json:"registeredat,omitempty"`
+	Changes       int             `json:"changes"`
+	History       []EthAddrChange `json:"history,omitempty"`
+	PayoutStatus  string          `json:"payoutstatus,omitempty"`
+	PayoutTx      string          `json:"payouttx,omitempty"`
+	PayoutBlock   uint64          `json:"payoutblock,omitempty"`
+}
+
+//Registration fields recorded when an account registers its ERC20 address
+type Registration struct {
+	EthAddr     string
+	EthVerified bool
+	EthContract bool
+	KeyDecision *KeyDecision
 }
 
 type Mongoc struct {
-	Client *mongo.Client
+	Client     *mongo.Client
+	nonceIndex sync.Once
 }
 
 func NewInstance(mongoURL string) (*Mongoc, error) {
@@ -28,20 +53,27 @@ func NewInstance(mongoURL string) (*Mongoc, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Mongoc{client}, nil
+	return &Mongoc{Client: client}, nil
+}
+
+//Close disconnect from MongoDB
+func (client *Mongoc) Close(ctx context.Context) error {
+	return client.Client.Disconnect(ctx)
 }
 
-func (client *Mongoc) Snapshot(accounts []*eostx.AccountsInfo, etx *eostx.Eostx) {
+//Snapshot take a snapshot of YTT balances identified by snapshotID, an empty ID uses the default snapshot collection
+//which also feeds registry, other IDs are comparison snapshots for DiffSnapshot only
+func (client *Mongoc) Snapshot(snapshotID string, accounts []*eostx.AccountsInfo, etx *eostx.Eostx) {
 	for i, acc := range accounts {
 		pubkey, err := etx.GetPubKey(acc.Scope)
 		if err != nil {
-			log.Printf("#%d# !!! get pubkey failed: %s ,error: %s\n", acc.Scope, err.Error())
+			log.Printf("#%d# !!! get pubkey failed: %s ,error: %s\n", i, acc.Scope, err.Error())
 			pubkey = ""
-		} else {
-			pubkey = strings.TrimLeft(pubkey, "YTA")
+		} else if pubkey, err = key.Canonical(pubkey); err != nil {
+			log.Printf("#%d# !!! parse pubkey failed: %s ,error: %s\n", i, acc.Scope, err.Error())
 		}
 		//_, err = collection.InsertOne(context.Background(), bson.M{"_id": acc.Scope, "pubkey": pubkey, "balance": acc.Bal, "ethaddr": "", "exclude": false})
-		err = client.AddSnapshot(acc.Scope, pubkey, acc.Bal)
+		err = client.AddSnapshot(snapshotID, acc.Scope, pubkey, acc.Bal)
 		if err != nil {
 			log.Printf("#%d# !!! error when snapshot: %s -> %d\n", i, acc.Scope, acc.Bal)
 			log.Printf("    %s\n", err.Error())
@@ -50,24 +82,117 @@ func (client *Mongoc) Snapshot(accounts []*eostx.AccountsInfo, etx *eostx.Eostx)
 	}
 }
 
-func (client *Mongoc) RegEthAddr(account, ethaddr string) error {
+//RegEthAddr register ethaddr of account whose current entry is prev, the previous address is pushed to history if changed,
+//returns ErrRegistryChanged if entry is modified after prev is read or queued for payout
+func (client *Mongoc) RegEthAddr(account string, prev *Registry, registration *Registration, origin *Origin) error {
 	collection := client.Client.Database("ytttransfer").Collection("registry")
-	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": account}, bson.M{"$set": bson.M{"ethaddr": ethaddr}})
-	if err != nil {
-		log.Printf("!!! error when registering ethaddress: %s -> %s : %s\n", account, ethaddr, err.Error())
-		return err
+	now := time.Now().Unix()
+	filter := bson.M{"_id": account, "ethaddr": prev.EthAddr, "changes": bson.M{"$in": bson.A{nil, prev.Changes}}, "payoutstatus": bson.M{"$in": bson.A{nil, ""}}}
+	update := bson.M{"$set": bson.M{"ethaddr": registration.EthAddr, "ethverified": registration.EthVerified, "ethcontract": registration.EthContract, "keydecision": registration.KeyDecision, "registeredat": now}}
+	if prev.EthAddr != "" && prev.EthAddr != registration.EthAddr {
+		update["$inc"] = bson.M{"changes": 1}
+		update["$push"] = bson.M{"history": &EthAddrChange{EthAddr: prev.EthAddr, RegisteredAt: prev.RegisteredAt, ReplacedAt: now}}
+	}
+	action := AuditRegister
+	if prev.EthAddr != "" {
+		action = AuditChange
+	}
+	return client.Audit(action, account, bson.M{"ethaddr": registration.EthAddr, "prev": prev.EthAddr, "ethverified": registration.EthVerified, "ethcontract": registration.EthContract, "keydecision": registration.KeyDecision}, origin, func() error {
+		ret, err := collection.UpdateOne(context.Background(), filter, update)
+		if err != nil {
+			log.Printf("!!! error when registering ethaddress: %s -> %s : %s\n", account, registration.EthAddr, err.Error())
+			return err
+		}
+		if ret.MatchedCount == 0 {
+			return ErrRegistryChanged
+		}
+		return nil
+	})
+}
+
+//QueuePayout mark accounts of exported distribution as queued for payout which freezes their ERC20 addresses,
+//an account is skipped if it is already queued, excluded, or its ERC20 address or balance has changed since export,
+//returns number of accounts queued
+func (client *Mongoc) QueuePayout(dist *Distribution) (int, error) {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	queued := 0
+	for _, e := range dist.Entries {
+		balance, ok := ToYTTBalance(e.Amount)
+		if !ok {
+			log.Printf("!!! skip queue payout: %s -> %s has invalid amount %s\n", e.Account, e.EthAddr.Hex(), e.Amount.String())
+			continue
+		}
+		filter := bson.M{"_id": e.Account, "ethaddr": primitive.Regex{Pattern: "^" + e.EthAddr.Hex() + "$", Options: "i"}, "exclude": false, "balance": balance, "payoutstatus": bson.M{"$in": bson.A{nil, ""}}}
+		n, err := collection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			log.Printf("!!! error when queue payout: %s -> %s\n", e.Account, err.Error())
+			return queued, err
+		}
+		if n == 0 {
+			log.Printf("!!! skip queue payout: %s -> %s is already queued, excluded, or its ERC20 address or balance has changed since export\n", e.Account, e.EthAddr.Hex())
+			continue
+		}
+		err = client.Audit(AuditPayout, e.Account, bson.M{"payoutstatus": PayoutQueued, "ethaddr": e.EthAddr.Hex()}, nil, func() error {
+			ret, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"payoutstatus": PayoutQueued}})
+			if err != nil {
+				log.Printf("!!! error when queue payout: %s -> %s\n", e.Account, err.Error())
+				return err
+			}
+			if ret.MatchedCount == 0 {
+				return ErrRegistryChanged
+			}
+			return nil
+		})
+		if err != nil {
+			return queued, err
+		}
+		queued++
 	}
-	return nil
+	return queued, nil
 }
 
-func (client *Mongoc) AddSnapshot(account, pubkey string, balance int64) error {
-	collection := client.Client.Database("ytttransfer").Collection("snapshot")
+//SetPayout set payout status of account with hash and block number of the transfer transaction,
+//returns ErrPayoutPaid if account has been paid since a paid account never leaves that state
+func (client *Mongoc) SetPayout(account, status, txHash string, block uint64, origin *Origin) error {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	return client.Audit(AuditPayout, account, bson.M{"payoutstatus": status, "payouttx": txHash, "payoutblock": block}, origin, func() error {
+		ret, err := collection.UpdateOne(context.Background(), bson.M{"_id": account, "payoutstatus": bson.M{"$ne": PayoutPaid}}, bson.M{"$set": bson.M{"payoutstatus": status, "payouttx": txHash, "payoutblock": block}})
+		if err != nil {
+			log.Printf("!!! error when set payout status: %s -> %s\n", account, err.Error())
+			return err
+		}
+		if ret.MatchedCount > 0 {
+			return nil
+		}
+		n, err := collection.CountDocuments(context.Background(), bson.M{"_id": account})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return ErrPayoutPaid
+	})
+}
+
+//AddSnapshot insert account into snapshot identified by snapshotID, registry is only updated by the default snapshot
+//so that a comparison snapshot never touches payout balances
+func (client *Mongoc) AddSnapshot(snapshotID, account, pubkey string, balance int64) error {
+	collection := client.Client.Database("ytttransfer").Collection(snapshotCollection(snapshotID))
 	collectionReg := client.Client.Database("ytttransfer").Collection("registry")
-	_, err := collection.InsertOne(context.Background(), bson.M{"_id": account, "pubkey": pubkey, "balance": balance, "ethaddr": "", "exclude": false})
+	err := client.Audit(AuditSnapshot, account, bson.M{"snapshot": snapshotCollection(snapshotID), "pubkey": pubkey, "balance": balance}, nil, func() error {
+		_, err := collection.InsertOne(context.Background(), bson.M{"_id": account, "pubkey": pubkey, "balance": balance, "ethaddr": "", "exclude": false})
+		if err != nil {
+			log.Printf("!!! error when insert snapshot: %s -> %s\n", account, err.Error())
+		}
+		return err
+	})
 	if err != nil {
-		log.Printf("!!! error when insert snapshot: %s -> %s\n", account, err.Error())
 		return err
 	}
+	if snapshotID != "" {
+		return nil
+	}
 	//Todo: update registry collection
 	ret := collectionReg.FindOne(context.Background(), bson.M{"_id": account})
 	if err = ret.Err(); err != nil {
@@ -78,20 +203,22 @@ func (client *Mongoc) AddSnapshot(account, pubkey string, balance int64) error {
 			return err
 		}
 	} else {
-		_, err = collectionReg.UpdateOne(context.Background(), bson.M{"_id": account}, bson.M{"$set": bson.M{"balance": balance}})
-		if err != nil {
-			log.Printf("!!! error when update registry when snapshoting: %s -> %s\n", account, err.Error())
+		return client.Audit(AuditRegistry, account, bson.M{"balance": balance}, nil, func() error {
+			_, err := collectionReg.UpdateOne(context.Background(), bson.M{"_id": account}, bson.M{"$set": bson.M{"balance": balance}})
+			if err != nil {
+				log.Printf("!!! error when update registry when snapshoting: %s -> %s\n", account, err.Error())
+			}
 			return err
-		} else {
-			return nil
-		}
+		})
 	}
 }
 
 func (client *Mongoc) AddRegistry(account, pubkey string, balance int64) error {
 	collection := client.Client.Database("ytttransfer").Collection("registry")
-	_, err := collection.InsertOne(context.Background(), bson.M{"_id": account, "pubkey": pubkey, "balance": balance, "ethaddr": "", "exclude": false})
-	return err
+	return client.Audit(AuditRegistry, account, bson.M{"pubkey": pubkey, "balance": balance}, nil, func() error {
+		_, err := collection.InsertOne(context.Background(), bson.M{"_id": account, "pubkey": pubkey, "balance": balance, "ethaddr": "", "exclude": false})
+		return err
+	})
 }
 
 func (client *Mongoc) GetAccountInfo(account string) (*Registry, error) {
@@ -104,3 +231,29 @@ func (client *Mongoc) GetAccountInfo(account string) (*Registry, error) {
 	}
 	return reg, nil
 }
+
+//GetRegistries list all accounts in registry
+func (client *Mongoc) GetRegistries() ([]*Registry, error) {
+	collection := client.Client.Database("ytttransfer").Collection("registry")
+	cur, err := collection.Find(context.Background(), bson.M{})
+	if err != nil {
+		log.Printf("!!! error when query registry: %s\n", err.Error())
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	regs := make([]*Registry, 0)
+	for cur.Next(context.Background()) {
+		reg := new(Registry)
+		err := cur.Decode(reg)
+		if err != nil {
+			log.Printf("!!! error when decode registry: %s\n", err.Error())
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	if err := cur.Err(); err != nil {
+		log.Printf("!!! error when iterate registry: %s\n", err.Error())
+		return nil, err
+	}
+	return regs, nil
+}